@@ -0,0 +1,473 @@
+package bayeux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 客户端生命周期事件，通过 Client.OnEvent 回调给调用方（日志/审计）
+const (
+	EventOpen        = "open"
+	EventHandshake   = "handshake"
+	EventSubscribe   = "subscribe"
+	EventUnsubscribe = "unsubscribe"
+	EventDisconnect  = "disconnect"
+	EventError       = "error"
+)
+
+var (
+	// ErrStopped 表示服务端建议 reconnect=none，客户端不会再重连
+	ErrStopped = errors.New("bayeux: server advised not to reconnect")
+
+	errRehandshake = errors.New("bayeux: server advised re-handshake")
+)
+
+// 订阅被拒绝时的重试次数与间隔，仍被拒绝则重建会话重新握手
+var (
+	subscribeAttempts  = 3
+	subscribeRetryWait = 2 * time.Second
+)
+
+// Client 是一个 Bayeux（Faye）客户端：握手、connect 循环、订阅与按通道分发消息，
+// 连接断开或服务端要求时按 advice 重连/重新握手，并自动恢复全部订阅。
+type Client struct {
+	// Transports 按优先级排列，每次建立会话时调用其中一个创建新的传输。
+	// 某个传输连握手都无法完成时自动换下一个；全部失败后退避，再从第一个重试。
+	// 后备传输上的会话结束（断开或要求重新握手）后，下一次会话同样先尝试第一个，首选传输恢复后即可换回。
+	Transports []func() Transport
+	// Ext 会附加到每一条发出的消息上
+	Ext map[string]interface{}
+	// OnEvent 接收生命周期事件，可为空
+	OnEvent func(event string, detail string)
+	// RequestTimeout 是握手、订阅等请求等待响应的时间
+	RequestTimeout time.Duration
+
+	mu       sync.Mutex
+	clientID string
+	nextID   int64
+	pending  map[string]chan Message
+	handlers map[string]func(Message)
+	advice   Advice
+	session  *session
+	current  string
+}
+
+// 一次传输连接上的会话，连接断开后整个会话作废
+type session struct {
+	transport Transport
+	broken    chan struct{}
+	once      sync.Once
+	err       error
+}
+
+func (s *session) fail(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.broken)
+	})
+}
+
+func NewClient(transports ...func() Transport) *Client {
+	return &Client{
+		Transports:     transports,
+		RequestTimeout: 10 * time.Second,
+		pending:        map[string]chan Message{},
+		handlers:       map[string]func(Message){},
+		advice:         Advice{Reconnect: ReconnectRetry},
+	}
+}
+
+func (c *Client) emit(event string, detail string) {
+	if c.OnEvent != nil {
+		c.OnEvent(event, detail)
+	}
+}
+
+// ClientID 返回当前握手得到的 clientId（未握手时为空）
+func (c *Client) ClientID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clientID
+}
+
+// Transport 返回当前会话使用的传输名称（未连接时为空）
+func (c *Client) Transport() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current
+}
+
+// Subscribe 登记通道处理函数。已连接时立即订阅并等待确认；
+// 未连接时会在下一次握手后订阅。
+func (c *Client) Subscribe(ctx context.Context, channel string, handler func(Message)) error {
+	c.mu.Lock()
+	c.handlers[channel] = handler
+	s := c.session
+	c.mu.Unlock()
+
+	if s == nil || c.ClientID() == "" {
+		return nil
+	}
+	return c.subscribeWithRetry(ctx, s, channel)
+}
+
+// Unsubscribe 取消订阅并移除处理函数
+func (c *Client) Unsubscribe(ctx context.Context, channel string) error {
+	c.mu.Lock()
+	delete(c.handlers, channel)
+	s := c.session
+	clientID := c.clientID
+	c.mu.Unlock()
+
+	if s == nil || clientID == "" {
+		return nil
+	}
+	reply, err := c.request(ctx, s, Message{Channel: ChannelUnsubscribe, ClientID: clientID, Subscription: channel})
+	if err != nil {
+		return err
+	}
+	if !reply.OK() {
+		return fmt.Errorf("unsubscribe %s: %s", channel, reply.Error)
+	}
+	c.emit(EventUnsubscribe, channel)
+	return nil
+}
+
+// Run 保持连接直到 ctx 结束。只有服务端建议不再重连时才返回 ErrStopped。
+func (c *Client) Run(ctx context.Context) error {
+	if len(c.Transports) == 0 {
+		return errors.New("bayeux: no transport configured")
+	}
+	failures := 0
+	idx := 0
+	for {
+		handshaken, err := c.runSession(ctx, c.Transports[idx]())
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !handshaken && !errors.Is(err, ErrStopped) && idx+1 < len(c.Transports) {
+			// 当前传输无法握手（例如 websocket 被代理拦截），立即换下一个
+			idx++
+			continue
+		}
+		// 无论是全部传输都失败，还是后备传输上的会话结束，下一次都从首选传输开始
+		idx = 0
+		if errors.Is(err, ErrStopped) {
+			c.emit(EventDisconnect, err.Error())
+			return err
+		}
+
+		c.mu.Lock()
+		if errors.Is(err, errRehandshake) {
+			c.clientID = ""
+		}
+		interval := time.Duration(c.advice.Interval) * time.Millisecond
+		c.mu.Unlock()
+
+		if errors.Is(err, errRehandshake) {
+			c.emit(EventDisconnect, "rehandshake")
+			failures = 0
+		} else {
+			c.emit(EventDisconnect, err.Error())
+			failures++
+		}
+
+		// 服务端建议的间隔优先，连续失败时指数退避（1s 起，最多 30s）
+		wait := interval
+		if failures > 0 {
+			backoff := time.Second << (failures - 1)
+			if backoff > 30*time.Second || backoff <= 0 {
+				backoff = 30 * time.Second
+			}
+			if backoff > wait {
+				wait = backoff
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runSession 在一个传输上完成握手、订阅与 connect 循环，handshaken 表示是否握手成功过
+func (c *Client) runSession(ctx context.Context, t Transport) (handshaken bool, err error) {
+	s := &session{transport: t, broken: make(chan struct{})}
+	if err := s.transport.Open(ctx, c.receive, s.fail); err != nil {
+		c.emit(EventError, s.transport.Name()+" open: "+err.Error())
+		return false, err
+	}
+	c.emit(EventOpen, s.transport.Name())
+
+	c.mu.Lock()
+	c.session = s
+	c.current = s.transport.Name()
+	c.clientID = ""
+	// 上一个会话的 reconnect=handshake 建议已经在这次握手中执行
+	c.advice.Reconnect = ReconnectRetry
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		if c.session == s {
+			c.session = nil
+			c.current = ""
+		}
+		c.mu.Unlock()
+		_ = s.transport.Close()
+	}()
+
+	// 1) handshake
+	reply, err := c.request(ctx, s, Message{
+		Channel:                  ChannelHandshake,
+		Version:                  "1.0",
+		MinimumVersion:           "1.0",
+		SupportedConnectionTypes: []string{s.transport.Name()},
+	})
+	if err != nil {
+		c.emit(EventError, "handshake: "+err.Error())
+		return false, err
+	}
+	c.applyAdvice(reply.Advice)
+	if !reply.OK() || reply.ClientID == "" {
+		c.emit(EventError, "handshake rejected: "+reply.Error)
+		if c.reconnectAdvice() == ReconnectNone {
+			return false, ErrStopped
+		}
+		return false, fmt.Errorf("handshake rejected: %s", reply.Error)
+	}
+	clientID := reply.ClientID
+	c.mu.Lock()
+	c.clientID = clientID
+	channels := make([]string, 0, len(c.handlers))
+	for ch := range c.handlers {
+		channels = append(channels, ch)
+	}
+	c.mu.Unlock()
+	c.emit(EventHandshake, clientID)
+
+	// 2) 恢复订阅，任何通道最终没有订阅上都重建会话，避免之后一直收不到该通道的消息
+	for _, ch := range channels {
+		if err := c.subscribeWithRetry(ctx, s, ch); err != nil {
+			return true, err
+		}
+	}
+
+	// 3) connect 循环：每个 connect 在服务端有消息或超时后返回，收到响应后按 interval 发下一个
+	for {
+		reply, err := c.requestWithTimeout(ctx, s, Message{
+			Channel:        ChannelConnect,
+			ClientID:       clientID,
+			ConnectionType: s.transport.Name(),
+		}, c.connectTimeout())
+		if err != nil {
+			if ctx.Err() != nil {
+				c.disconnect(s)
+			}
+			return true, err
+		}
+		c.applyAdvice(reply.Advice)
+		switch c.reconnectAdvice() {
+		case ReconnectNone:
+			return true, ErrStopped
+		case ReconnectHandshake:
+			return true, errRehandshake
+		}
+		if !reply.OK() {
+			return true, fmt.Errorf("connect failed: %s", reply.Error)
+		}
+
+		c.mu.Lock()
+		interval := time.Duration(c.advice.Interval) * time.Millisecond
+		c.mu.Unlock()
+		if interval > 0 {
+			select {
+			case <-ctx.Done():
+				c.disconnect(s)
+				return true, ctx.Err()
+			case <-s.broken:
+				return true, s.err
+			case <-time.After(interval):
+			}
+		}
+	}
+}
+
+func (c *Client) subscribe(ctx context.Context, s *session, channel string) error {
+	reply, err := c.request(ctx, s, Message{Channel: ChannelSubscribe, ClientID: c.ClientID(), Subscription: channel})
+	if err != nil {
+		c.emit(EventError, "subscribe "+channel+": "+err.Error())
+		return err
+	}
+	c.applyAdvice(reply.Advice)
+	if !reply.OK() {
+		c.emit(EventError, "subscribe "+channel+" rejected: "+reply.Error)
+		return fmt.Errorf("subscribe %s rejected: %s", channel, reply.Error)
+	}
+	c.emit(EventSubscribe, channel)
+	return nil
+}
+
+// subscribeWithRetry 在通道被拒绝时按 subscribeRetryWait 重试，仍被拒绝时让会话失败，
+// 由 Run 退避后重新握手并恢复全部订阅
+func (c *Client) subscribeWithRetry(ctx context.Context, s *session, channel string) error {
+	var err error
+	for i := 0; i < subscribeAttempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-s.broken:
+				return s.err
+			case <-time.After(subscribeRetryWait):
+			}
+		}
+		if err = c.subscribe(ctx, s, channel); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-s.broken:
+			// 连接本身出错，会话已作废
+			return err
+		default:
+		}
+		switch c.reconnectAdvice() {
+		case ReconnectHandshake:
+			// 服务端不认识这个 clientId（如会话已过期），重试没有意义
+			s.fail(errRehandshake)
+			return errRehandshake
+		case ReconnectNone:
+			s.fail(ErrStopped)
+			return ErrStopped
+		}
+	}
+	s.fail(err)
+	return err
+}
+
+// 尽力发送 /meta/disconnect，不等待响应
+func (c *Client) disconnect(s *session) {
+	clientID := c.ClientID()
+	if clientID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = s.transport.Send(ctx, []Message{c.withExt(Message{Channel: ChannelDisconnect, ClientID: clientID})})
+}
+
+func (c *Client) request(ctx context.Context, s *session, msg Message) (Message, error) {
+	return c.requestWithTimeout(ctx, s, msg, c.RequestTimeout)
+}
+
+func (c *Client) requestWithTimeout(ctx context.Context, s *session, msg Message, timeout time.Duration) (Message, error) {
+	c.mu.Lock()
+	c.nextID++
+	msg.ID = strconv.FormatInt(c.nextID, 10)
+	ch := make(chan Message, 1)
+	c.pending[msg.ID] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+	}()
+
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// long-polling 等同步传输会在 Send 内部收到响应并回调 receive
+	if err := s.transport.Send(reqCtx, []Message{c.withExt(msg)}); err != nil {
+		s.fail(err)
+		return Message{}, err
+	}
+
+	select {
+	case reply := <-ch:
+		return reply, nil
+	case <-s.broken:
+		return Message{}, s.err
+	case <-reqCtx.Done():
+		if ctx.Err() != nil {
+			return Message{}, ctx.Err()
+		}
+		err := fmt.Errorf("%s timeout after %s", msg.Channel, timeout)
+		s.fail(err)
+		return Message{}, err
+	}
+}
+
+func (c *Client) withExt(msg Message) Message {
+	if msg.Ext == nil && len(c.Ext) > 0 {
+		msg.Ext = c.Ext
+	}
+	return msg
+}
+
+// receive 处理服务端消息：元通道响应交给等待中的请求，其余按通道分发
+func (c *Client) receive(msgs []Message) {
+	for _, m := range msgs {
+		if m.IsMeta() {
+			c.mu.Lock()
+			ch, ok := c.pending[m.ID]
+			c.mu.Unlock()
+			if ok {
+				ch <- m
+			} else {
+				c.applyAdvice(m.Advice)
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		var matched []func(Message)
+		for pattern, h := range c.handlers {
+			if matchChannel(pattern, m.Channel) {
+				matched = append(matched, h)
+			}
+		}
+		c.mu.Unlock()
+		for _, h := range matched {
+			h(m)
+		}
+	}
+}
+
+func (c *Client) applyAdvice(a *Advice) {
+	if a == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if a.Reconnect != "" {
+		c.advice.Reconnect = a.Reconnect
+	}
+	c.advice.Interval = a.Interval
+	if a.Timeout > 0 {
+		c.advice.Timeout = a.Timeout
+	}
+}
+
+func (c *Client) reconnectAdvice() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.advice.Reconnect
+}
+
+// connect 会被服务端挂起到 advice.timeout，再留出余量
+func (c *Client) connectTimeout() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timeout := time.Duration(c.advice.Timeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 45 * time.Second
+	}
+	return timeout + 15*time.Second
+}
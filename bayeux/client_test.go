@@ -0,0 +1,338 @@
+package bayeux
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	subscribeRetryWait = 20 * time.Millisecond
+}
+
+// testClient 记录生命周期事件，并在测试结束时停止 Run
+type testClient struct {
+	*Client
+	mu     sync.Mutex
+	events []string
+	done   chan error
+}
+
+func startClient(t *testing.T, c *Client, channels map[string]chan Message) *testClient {
+	t.Helper()
+	tc := &testClient{Client: c, done: make(chan error, 1)}
+	c.RequestTimeout = 2 * time.Second
+	c.OnEvent = func(event string, detail string) {
+		tc.mu.Lock()
+		tc.events = append(tc.events, event+" "+detail)
+		tc.mu.Unlock()
+	}
+	for channel, ch := range channels {
+		ch := ch
+		if err := c.Subscribe(context.Background(), channel, func(m Message) { ch <- m }); err != nil {
+			t.Fatalf("subscribe %s before run: %v", channel, err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { tc.done <- c.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-tc.done:
+		case <-time.After(5 * time.Second):
+			t.Error("Run did not return after cancel")
+		}
+	})
+	return tc
+}
+
+func (tc *testClient) hasEvent(e string) bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	for _, got := range tc.events {
+		if got == e {
+			return true
+		}
+	}
+	return false
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, ch chan Message) Message {
+	t.Helper()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return Message{}
+}
+
+func TestWebSocketHandshakeAndSubscribe(t *testing.T) {
+	f := newFakeFaye(t)
+	msgs := make(chan Message, 4)
+	tc := startClient(t, NewClient(func() Transport { return NewWebSocketTransport(f.wsURL(), nil) }),
+		map[string]chan Message{"/attendance/1/qr": msgs})
+
+	waitFor(t, "subscribe ack", func() bool { return tc.hasEvent(EventSubscribe + " /attendance/1/qr") })
+	if got := tc.Transport(); got != "websocket" {
+		t.Fatalf("transport = %q, want websocket", got)
+	}
+	id := tc.ClientID()
+	if id != "client-1" {
+		t.Fatalf("clientId = %q, want client-1", id)
+	}
+	if subs := f.subscribed(id); len(subs) != 1 || subs[0] != "/attendance/1/qr" {
+		t.Fatalf("server subscriptions = %v", subs)
+	}
+
+	f.publish("/attendance/1/qr", `{"qrUrl":"https://example.com/qr/1"}`)
+	m := receive(t, msgs)
+	if string(m.Data) != `{"qrUrl":"https://example.com/qr/1"}` {
+		t.Fatalf("data = %s", m.Data)
+	}
+}
+
+func TestSubscribeWhileConnected(t *testing.T) {
+	f := newFakeFaye(t)
+	tc := startClient(t, NewClient(func() Transport { return NewWebSocketTransport(f.wsURL(), nil) }), nil)
+	waitFor(t, "handshake", func() bool { return tc.ClientID() != "" })
+
+	msgs := make(chan Message, 1)
+	if err := tc.Subscribe(context.Background(), "/late", func(m Message) { msgs <- m }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	f.publish("/late", `1`)
+	receive(t, msgs)
+
+	if err := tc.Unsubscribe(context.Background(), "/late"); err != nil {
+		t.Fatalf("unsubscribe: %v", err)
+	}
+	if subs := f.subscribed(tc.ClientID()); len(subs) != 0 {
+		t.Fatalf("server subscriptions after unsubscribe = %v", subs)
+	}
+}
+
+func TestSubscribeRejectionIsRetried(t *testing.T) {
+	f := newFakeFaye(t)
+	f.rejectSubs["/qr"] = subscribeAttempts - 1
+	msgs := make(chan Message, 1)
+	tc := startClient(t, NewClient(func() Transport { return NewWebSocketTransport(f.wsURL(), nil) }),
+		map[string]chan Message{"/qr": msgs})
+
+	waitFor(t, "subscribe ack", func() bool { return tc.hasEvent(EventSubscribe + " /qr") })
+	if !tc.hasEvent(EventError + " subscribe /qr rejected: 403:/qr:Forbidden channel") {
+		t.Fatal("rejection was not reported")
+	}
+	if n := f.handshakeCount(); n != 1 {
+		t.Fatalf("handshakes = %d, want 1 (retried within the session)", n)
+	}
+	f.publish("/qr", `1`)
+	receive(t, msgs)
+}
+
+func TestPersistentSubscribeRejectionRehandshakes(t *testing.T) {
+	f := newFakeFaye(t)
+	f.rejectSubs["/qr"] = subscribeAttempts
+	msgs := make(chan Message, 1)
+	tc := startClient(t, NewClient(func() Transport { return NewWebSocketTransport(f.wsURL(), nil) }),
+		map[string]chan Message{"/qr": msgs})
+
+	waitFor(t, "subscribe ack", func() bool { return tc.hasEvent(EventSubscribe + " /qr") })
+	if n := f.handshakeCount(); n != 2 {
+		t.Fatalf("handshakes = %d, want 2", n)
+	}
+	if id := tc.ClientID(); id != "client-2" {
+		t.Fatalf("clientId = %q, want client-2", id)
+	}
+	f.publish("/qr", `1`)
+	receive(t, msgs)
+}
+
+func TestAdviceRehandshakeRestoresSubscriptions(t *testing.T) {
+	f := newFakeFaye(t)
+	msgs := make(chan Message, 1)
+	tc := startClient(t, NewClient(func() Transport { return NewWebSocketTransport(f.wsURL(), nil) }),
+		map[string]chan Message{"/qr": msgs})
+	waitFor(t, "first handshake", func() bool { return tc.ClientID() == "client-1" })
+
+	f.mu.Lock()
+	f.rehandshakeNext = true
+	f.mu.Unlock()
+
+	waitFor(t, "re-handshake", func() bool { return tc.ClientID() == "client-2" })
+	waitFor(t, "subscription restored", func() bool { return len(f.subscribed("client-2")) == 1 })
+	if !tc.hasEvent(EventDisconnect + " rehandshake") {
+		t.Fatal("re-handshake was not reported")
+	}
+	f.publish("/qr", `1`)
+	receive(t, msgs)
+}
+
+func TestAdviceNoneStops(t *testing.T) {
+	f := newFakeFaye(t)
+	f.stopHandshake = true
+	c := NewClient(func() Transport { return NewWebSocketTransport(f.wsURL(), nil) })
+	c.RequestTimeout = 2 * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Run(ctx); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Run = %v, want ErrStopped", err)
+	}
+}
+
+func TestLongPollingFallback(t *testing.T) {
+	f := newFakeFaye(t)
+	f.refuseWebsocket = true
+	msgs := make(chan Message, 1)
+	tc := startClient(t, NewClient(
+		func() Transport { return NewWebSocketTransport(f.wsURL(), nil) },
+		func() Transport { return NewLongPollingTransport(f.server.URL, nil) },
+	), map[string]chan Message{"/qr": msgs})
+
+	waitFor(t, "subscribe ack", func() bool { return tc.hasEvent(EventSubscribe + " /qr") })
+	if got := tc.Transport(); got != "long-polling" {
+		t.Fatalf("transport = %q, want long-polling", got)
+	}
+	if !tc.hasEvent(EventOpen + " long-polling") {
+		t.Fatal("long-polling open was not reported")
+	}
+	f.publish("/qr", `"polled"`)
+	if m := receive(t, msgs); string(m.Data) != `"polled"` {
+		t.Fatalf("data = %s", m.Data)
+	}
+}
+
+// 回退到 long-polling 后，重新握手时再次尝试 websocket
+func TestFallbackRetriesWebSocketOnRehandshake(t *testing.T) {
+	f := newFakeFaye(t)
+	f.refuseWebsocket = true
+	msgs := make(chan Message, 1)
+	tc := startClient(t, NewClient(
+		func() Transport { return NewWebSocketTransport(f.wsURL(), nil) },
+		func() Transport { return NewLongPollingTransport(f.server.URL, nil) },
+	), map[string]chan Message{"/qr": msgs})
+	waitFor(t, "long-polling session", func() bool { return tc.ClientID() == "client-1" })
+	if got := tc.Transport(); got != "long-polling" {
+		t.Fatalf("transport = %q, want long-polling", got)
+	}
+
+	f.mu.Lock()
+	f.refuseWebsocket = false
+	f.rehandshakeNext = true
+	f.mu.Unlock()
+
+	waitFor(t, "re-handshake", func() bool { return tc.ClientID() == "client-2" })
+	f.mu.Lock()
+	used := f.transports[1]
+	f.mu.Unlock()
+	if used != "websocket" {
+		t.Fatalf("re-handshake used %q, want websocket", used)
+	}
+	waitFor(t, "subscription restored", func() bool { return len(f.subscribed("client-2")) == 1 })
+	if got := tc.Transport(); got != "websocket" {
+		t.Fatalf("transport = %q, want websocket", got)
+	}
+	f.publish("/qr", `3`)
+	receive(t, msgs)
+}
+
+func TestCallbackPolling(t *testing.T) {
+	f := newFakeFaye(t)
+	msgs := make(chan Message, 1)
+	tc := startClient(t, NewClient(func() Transport { return NewCallbackPollingTransport(f.server.URL, nil) }),
+		map[string]chan Message{"/qr": msgs})
+
+	waitFor(t, "subscribe ack", func() bool { return tc.hasEvent(EventSubscribe + " /qr") })
+	f.mu.Lock()
+	used := f.transports[0]
+	f.mu.Unlock()
+	if used != "callback-polling" {
+		t.Fatalf("server saw %q, want callback-polling", used)
+	}
+	f.publish("/qr", `2`)
+	receive(t, msgs)
+}
+
+func TestChannelRouting(t *testing.T) {
+	f := newFakeFaye(t)
+	one := make(chan Message, 4)
+	deep := make(chan Message, 4)
+	exact := make(chan Message, 4)
+	tc := startClient(t, NewClient(func() Transport { return NewWebSocketTransport(f.wsURL(), nil) }),
+		map[string]chan Message{"/course/*": one, "/course/**": deep, "/course/1/qr": exact})
+	waitFor(t, "subscriptions", func() bool { return len(f.subscribed(tc.ClientID())) == 3 })
+
+	f.publish("/course/1", `"a"`)
+	f.publish("/course/1/qr", `"b"`)
+	f.publish("/other", `"c"`)
+	f.publish("/course/2", `"d"`)
+
+	// /course/2 晚于其它消息发布，收到它时前面的消息都已分发完
+	if m := receive(t, one); m.Channel != "/course/1" {
+		t.Fatalf("/course/* got %s first", m.Channel)
+	}
+	if m := receive(t, one); m.Channel != "/course/2" {
+		t.Fatalf("/course/* got %s second", m.Channel)
+	}
+	for _, want := range []string{"/course/1", "/course/1/qr", "/course/2"} {
+		if m := receive(t, deep); m.Channel != want {
+			t.Fatalf("/course/** got %s, want %s", m.Channel, want)
+		}
+	}
+	if m := receive(t, exact); m.Channel != "/course/1/qr" {
+		t.Fatalf("exact got %s", m.Channel)
+	}
+	if len(one)+len(deep)+len(exact) != 0 {
+		t.Fatal("unexpected extra messages")
+	}
+}
+
+func TestMatchChannel(t *testing.T) {
+	cases := []struct {
+		pattern, channel string
+		want             bool
+	}{
+		{"/a/b", "/a/b", true},
+		{"/a/b", "/a/c", false},
+		{"/a/*", "/a/b", true},
+		{"/a/*", "/a/b/c", false},
+		{"/a/*", "/a/", false},
+		{"/a/**", "/a/b", true},
+		{"/a/**", "/a/b/c", true},
+		{"/a/**", "/ab", false},
+	}
+	for _, c := range cases {
+		if got := matchChannel(c.pattern, c.channel); got != c.want {
+			t.Errorf("matchChannel(%q, %q) = %v, want %v", c.pattern, c.channel, got, c.want)
+		}
+	}
+}
+
+func TestDecodeMessages(t *testing.T) {
+	arr, err := decodeMessages([]byte(`[{"channel":"/a"},{"channel":"/b"}]`))
+	if err != nil || len(arr) != 2 || arr[1].Channel != "/b" {
+		t.Fatalf("array: %v %v", arr, err)
+	}
+	single, err := decodeMessages([]byte(`{"channel":"/meta/connect","successful":true}`))
+	if err != nil || len(single) != 1 || !single[0].OK() {
+		t.Fatalf("single: %v %v", single, err)
+	}
+	if _, err := decodeMessages([]byte(`nope`)); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+}
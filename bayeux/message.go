@@ -0,0 +1,83 @@
+package bayeux
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Bayeux 元通道
+const (
+	ChannelHandshake   = "/meta/handshake"
+	ChannelConnect     = "/meta/connect"
+	ChannelDisconnect  = "/meta/disconnect"
+	ChannelSubscribe   = "/meta/subscribe"
+	ChannelUnsubscribe = "/meta/unsubscribe"
+)
+
+// Advice 重连建议取值
+const (
+	ReconnectRetry     = "retry"
+	ReconnectHandshake = "handshake"
+	ReconnectNone      = "none"
+)
+
+// Message 是一条 Bayeux 消息，请求与响应共用同一结构
+type Message struct {
+	ID                       string                 `json:"id,omitempty"`
+	Channel                  string                 `json:"channel"`
+	ClientID                 string                 `json:"clientId,omitempty"`
+	Version                  string                 `json:"version,omitempty"`
+	MinimumVersion           string                 `json:"minimumVersion,omitempty"`
+	SupportedConnectionTypes []string               `json:"supportedConnectionTypes,omitempty"`
+	ConnectionType           string                 `json:"connectionType,omitempty"`
+	Subscription             string                 `json:"subscription,omitempty"`
+	Successful               *bool                  `json:"successful,omitempty"`
+	Error                    string                 `json:"error,omitempty"`
+	Advice                   *Advice                `json:"advice,omitempty"`
+	Ext                      map[string]interface{} `json:"ext,omitempty"`
+	Data                     json.RawMessage        `json:"data,omitempty"`
+}
+
+// Advice 是服务端给出的重连建议，Interval/Timeout 单位为毫秒
+type Advice struct {
+	Reconnect string `json:"reconnect,omitempty"`
+	Interval  int    `json:"interval"`
+	Timeout   int    `json:"timeout,omitempty"`
+}
+
+func (m Message) IsMeta() bool {
+	return strings.HasPrefix(m.Channel, "/meta/")
+}
+
+func (m Message) OK() bool {
+	return m.Successful != nil && *m.Successful
+}
+
+// decodeMessages 兼容服务端返回数组或单个对象
+func decodeMessages(b []byte) ([]Message, error) {
+	var arr []Message
+	if err := json.Unmarshal(b, &arr); err == nil {
+		return arr, nil
+	}
+	var single Message
+	if err := json.Unmarshal(b, &single); err != nil {
+		return nil, err
+	}
+	return []Message{single}, nil
+}
+
+// matchChannel 支持 Bayeux 通配：/foo/* 匹配一段，/foo/** 匹配多段
+func matchChannel(pattern, channel string) bool {
+	if pattern == channel {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/**") {
+		return strings.HasPrefix(channel, strings.TrimSuffix(pattern, "**"))
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		prefix := strings.TrimSuffix(pattern, "*")
+		rest := strings.TrimPrefix(channel, prefix)
+		return strings.HasPrefix(channel, prefix) && rest != "" && !strings.Contains(rest, "/")
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package bayeux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// LongPollingTransport 通过 HTTP POST 发送消息，服务端在响应体里返回结果。
+// /meta/connect 会被服务端挂起，直到有消息或超时，用于 websocket 被拦截的网络。
+type LongPollingTransport struct {
+	URL    string
+	Header http.Header
+	Client *http.Client
+
+	recv func([]Message)
+}
+
+func NewLongPollingTransport(url string, header http.Header) *LongPollingTransport {
+	return &LongPollingTransport{URL: url, Header: header, Client: http.DefaultClient}
+}
+
+func (t *LongPollingTransport) Name() string { return "long-polling" }
+
+func (t *LongPollingTransport) Open(ctx context.Context, recv func([]Message), fail func(error)) error {
+	t.recv = recv
+	return nil
+}
+
+func (t *LongPollingTransport) Send(ctx context.Context, msgs []Message) error {
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	copyHeader(req.Header, t.Header)
+	req.Header.Set("Content-Type", "application/json")
+
+	body, err := doRequest(t.Client, req)
+	if err != nil {
+		return err
+	}
+	replies, err := decodeMessages(body)
+	if err != nil {
+		return fmt.Errorf("decode long-polling response: %w", err)
+	}
+	t.recv(replies)
+	return nil
+}
+
+func (t *LongPollingTransport) Close() error { return nil }
+
+// CallbackPollingTransport 是 JSONP 形式的长轮询：消息放在 GET 参数里，
+// 只在连 POST 也被代理拦截时使用。
+type CallbackPollingTransport struct {
+	URL    string
+	Header http.Header
+	Client *http.Client
+
+	recv func([]Message)
+}
+
+const jsonpCallback = "__wzj_jsonp"
+
+func NewCallbackPollingTransport(url string, header http.Header) *CallbackPollingTransport {
+	return &CallbackPollingTransport{URL: url, Header: header, Client: http.DefaultClient}
+}
+
+func (t *CallbackPollingTransport) Name() string { return "callback-polling" }
+
+func (t *CallbackPollingTransport) Open(ctx context.Context, recv func([]Message), fail func(error)) error {
+	t.recv = recv
+	return nil
+}
+
+func (t *CallbackPollingTransport) Send(ctx context.Context, msgs []Message) error {
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("message", string(b))
+	q.Set("jsonp", jsonpCallback)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	copyHeader(req.Header, t.Header)
+
+	body, err := doRequest(t.Client, req)
+	if err != nil {
+		return err
+	}
+	// 响应形如 /**/__wzj_jsonp([...]);
+	start := bytes.IndexByte(body, '(')
+	end := bytes.LastIndexByte(body, ')')
+	if start < 0 || end <= start {
+		return fmt.Errorf("unexpected callback-polling response: %.80s", body)
+	}
+	replies, err := decodeMessages(body[start+1 : end])
+	if err != nil {
+		return fmt.Errorf("decode callback-polling response: %w", err)
+	}
+	t.recv(replies)
+	return nil
+}
+
+func (t *CallbackPollingTransport) Close() error { return nil }
+
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: HTTP %d", req.Method, req.URL.Host, resp.StatusCode)
+	}
+	return body, nil
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vs := range src {
+		dst[k] = append([]string(nil), vs...)
+	}
+}
@@ -0,0 +1,238 @@
+package bayeux
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeFaye 是测试用的最小 Faye 服务端：同一个地址同时支持 websocket、long-polling 与 callback-polling，
+// connect 挂起到有消息发布或 connectHold 超时。
+type fakeFaye struct {
+	t      *testing.T
+	server *httptest.Server
+	done   chan struct{}
+	outbox chan Message
+
+	mu              sync.Mutex
+	handshakes      int
+	transports      []string            // 每次握手使用的传输
+	subs            map[string][]string // clientId -> 已订阅的通道
+	rejectSubs      map[string]int      // 通道 -> 剩余拒绝次数
+	rehandshakeNext bool                // 下一个 connect 要求重新握手
+	refuseWebsocket bool
+	stopHandshake   bool // 握手返回 reconnect=none
+	connectHold     time.Duration
+}
+
+func newFakeFaye(t *testing.T) *fakeFaye {
+	f := &fakeFaye{
+		t:           t,
+		done:        make(chan struct{}),
+		outbox:      make(chan Message, 16),
+		subs:        map[string][]string{},
+		rejectSubs:  map[string]int{},
+		connectHold: 200 * time.Millisecond,
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(func() {
+		close(f.done)
+		f.server.Close()
+	})
+	return f
+}
+
+func (f *fakeFaye) wsURL() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+// publish 把一条消息交给下一个 connect 响应
+func (f *fakeFaye) publish(channel string, data string) {
+	f.outbox <- Message{Channel: channel, Data: json.RawMessage(data)}
+}
+
+func (f *fakeFaye) handshakeCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.handshakes
+}
+
+func (f *fakeFaye) subscribed(clientID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.subs[clientID]...)
+}
+
+func (f *fakeFaye) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		f.mu.Lock()
+		refuse := f.refuseWebsocket
+		f.mu.Unlock()
+		if refuse {
+			http.Error(w, "websocket blocked", http.StatusForbidden)
+			return
+		}
+		f.serveWebSocket(w, r)
+		return
+	}
+
+	var body []byte
+	var err error
+	jsonp := ""
+	if r.Method == http.MethodGet {
+		body = []byte(r.URL.Query().Get("message"))
+		jsonp = r.URL.Query().Get("jsonp")
+	} else {
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	msgs, err := decodeMessages(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	connType := "long-polling"
+	if jsonp != "" {
+		connType = "callback-polling"
+	}
+	b, _ := json.Marshal(f.handle(msgs, connType))
+	if jsonp != "" {
+		fmt.Fprintf(w, "/**/%s(%s);", jsonp, b)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func (f *fakeFaye) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	var writeMu sync.Mutex
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		msgs, err := decodeMessages(b)
+		if err != nil {
+			continue
+		}
+		// connect 会挂起，每帧单独处理，其它请求不被阻塞
+		go func() {
+			out, _ := json.Marshal(f.handle(msgs, "websocket"))
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			_ = conn.WriteMessage(websocket.TextMessage, out)
+		}()
+	}
+}
+
+func (f *fakeFaye) handle(msgs []Message, connType string) []Message {
+	var out []Message
+	for _, m := range msgs {
+		out = append(out, f.handleOne(m, connType)...)
+	}
+	return out
+}
+
+func reply(m Message, ok bool) Message {
+	return Message{ID: m.ID, Channel: m.Channel, ClientID: m.ClientID, Subscription: m.Subscription, Successful: &ok}
+}
+
+func (f *fakeFaye) handleOne(m Message, connType string) []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if m.Channel != ChannelHandshake {
+		if _, ok := f.subs[m.ClientID]; !ok {
+			r := reply(m, false)
+			r.Error = "401:" + m.ClientID + ":Unknown client"
+			r.Advice = &Advice{Reconnect: ReconnectHandshake}
+			return []Message{r}
+		}
+	}
+
+	switch m.Channel {
+	case ChannelHandshake:
+		if f.stopHandshake {
+			r := reply(m, false)
+			r.Error = "403::Handshake denied"
+			r.Advice = &Advice{Reconnect: ReconnectNone}
+			return []Message{r}
+		}
+		f.handshakes++
+		f.transports = append(f.transports, connType)
+		r := reply(m, true)
+		r.ClientID = fmt.Sprintf("client-%d", f.handshakes)
+		r.Version = "1.0"
+		r.SupportedConnectionTypes = []string{"websocket", "long-polling", "callback-polling"}
+		r.Advice = &Advice{Reconnect: ReconnectRetry, Timeout: int(f.connectHold / time.Millisecond)}
+		f.subs[r.ClientID] = []string{}
+		return []Message{r}
+
+	case ChannelSubscribe:
+		if f.rejectSubs[m.Subscription] > 0 {
+			f.rejectSubs[m.Subscription]--
+			r := reply(m, false)
+			r.Error = "403:" + m.Subscription + ":Forbidden channel"
+			return []Message{r}
+		}
+		f.subs[m.ClientID] = append(f.subs[m.ClientID], m.Subscription)
+		return []Message{reply(m, true)}
+
+	case ChannelUnsubscribe:
+		subs := f.subs[m.ClientID][:0]
+		for _, ch := range f.subs[m.ClientID] {
+			if ch != m.Subscription {
+				subs = append(subs, ch)
+			}
+		}
+		f.subs[m.ClientID] = subs
+		return []Message{reply(m, true)}
+
+	case ChannelDisconnect:
+		delete(f.subs, m.ClientID)
+		return []Message{reply(m, true)}
+
+	case ChannelConnect:
+		if f.rehandshakeNext {
+			f.rehandshakeNext = false
+			delete(f.subs, m.ClientID)
+			r := reply(m, false)
+			r.Error = "401:" + m.ClientID + ":Unknown client"
+			r.Advice = &Advice{Reconnect: ReconnectHandshake}
+			return []Message{r}
+		}
+		hold := f.connectHold
+		f.mu.Unlock()
+		var out []Message
+		select {
+		case pub := <-f.outbox:
+			out = append(out, pub)
+		case <-time.After(hold):
+		case <-f.done:
+		}
+		f.mu.Lock()
+		r := reply(m, true)
+		r.Advice = &Advice{Reconnect: ReconnectRetry, Timeout: int(hold / time.Millisecond)}
+		return append(out, r)
+	}
+
+	r := reply(m, false)
+	r.Error = "400::Unknown channel"
+	return []Message{r}
+}
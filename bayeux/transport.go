@@ -0,0 +1,80 @@
+package bayeux
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport 负责把消息送到服务端，并把服务端返回/推送的消息交给 recv。
+// 连接不可用时调用 fail，客户端会关闭它并重新握手。
+type Transport interface {
+	Name() string
+	Open(ctx context.Context, recv func([]Message), fail func(error)) error
+	Send(ctx context.Context, msgs []Message) error
+	Close() error
+}
+
+// WebSocketTransport 是 Bayeux 的 websocket 传输
+type WebSocketTransport struct {
+	URL    string
+	Header http.Header
+	Dialer *websocket.Dialer
+
+	writeMu sync.Mutex
+	conn    *websocket.Conn
+}
+
+func NewWebSocketTransport(url string, header http.Header) *WebSocketTransport {
+	return &WebSocketTransport{URL: url, Header: header, Dialer: websocket.DefaultDialer}
+}
+
+func (t *WebSocketTransport) Name() string { return "websocket" }
+
+func (t *WebSocketTransport) Open(ctx context.Context, recv func([]Message), fail func(error)) error {
+	conn, _, err := t.Dialer.DialContext(ctx, t.URL, t.Header)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+
+	go func() {
+		for {
+			_, b, err := conn.ReadMessage()
+			if err != nil {
+				fail(err)
+				return
+			}
+			msgs, err := decodeMessages(b)
+			if err != nil {
+				// 无法解析的帧直接忽略
+				continue
+			}
+			recv(msgs)
+		}
+	}()
+	return nil
+}
+
+func (t *WebSocketTransport) Send(ctx context.Context, msgs []Message) error {
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = t.conn.SetWriteDeadline(deadline)
+	}
+	return t.conn.WriteMessage(websocket.TextMessage, b)
+}
+
+func (t *WebSocketTransport) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.Close()
+}
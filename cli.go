@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"wzj_signin/db"
+	"wzj_signin/history"
+)
+
+// runCommand 处理命令行子命令，返回 false 表示不是子命令（正常启动服务）
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "export":
+		if err := runExport(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "export:", err)
+			os.Exit(1)
+		}
+		return true
+	}
+	return false
+}
+
+// wzj_signin export -format csv|jsonl|ics [-openid a,b] [-course N] [-from 2024-03-01] [-to ...] [-o file]
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "csv / jsonl / ics")
+	openIds := fs.String("openid", "", "只导出这些 OpenID（逗号分隔）")
+	course := fs.Int("course", 0, "只导出该课程")
+	from := fs.String("from", "", "开始时间（RFC3339 / 2006-01-02 / Unix 秒）")
+	to := fs.String("to", "", "结束时间")
+	out := fs.String("o", "", "输出文件，默认标准输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f := history.Filter{CourseId: *course}
+	for _, id := range strings.Split(*openIds, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			f.OpenIds = append(f.OpenIds, id)
+		}
+	}
+	var err error
+	if f.From, err = history.ParseTime(*from); err != nil {
+		return err
+	}
+	if f.To, err = history.ParseEndTime(*to); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	db.InitRedis()
+	switch *format {
+	case "csv":
+		return history.WriteCSV(w, f)
+	case "jsonl":
+		return history.WriteJSONL(w, f)
+	case "ics":
+		return history.WriteICS(w, f, "微助教签到", 10*time.Minute)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const accountSettingsFile = "account_settings.json"
+
+// EscalationSettings 是二维码签到无人响应时的升级策略，各步骤的分钟数为 0 表示不启用该步骤
+type EscalationSettings struct {
+	Enabled               bool     `json:"enabled"`
+	ResendAfterMinutes    int      `json:"resendAfterMinutes"`    // 多久后重发提醒
+	MaxResends            int      `json:"maxResends"`            // 最多重发次数
+	SecondaryEmail        string   `json:"secondaryEmail"`        // 备用通知邮箱
+	SecondaryAfterMinutes int      `json:"secondaryAfterMinutes"` // 多久后通知备用邮箱
+	Buddies               []string `json:"buddies"`               // 同课程的同学邮箱
+	BuddyAfterMinutes     int      `json:"buddyAfterMinutes"`     // 多久后请同学帮忙
+}
+
+// NotifyChannel 是账号的一个通知渠道。通用字段按渠道类型解释：
+// email 的 target 为收件地址（留空为账号邮箱），webhook 的 target 为 URL 等；其它参数放在 options。
+type NotifyChannel struct {
+	ID       string            `json:"id"`   // 渠道标识，同一账号内唯一，默认与 type 相同
+	Type     string            `json:"type"` // email / webhook / ...
+	Enabled  bool              `json:"enabled"`
+	Events   []string          `json:"events,omitempty"` // 订阅的事件，留空为默认事件
+	Target   string            `json:"target,omitempty"`
+	Secret   string            `json:"secret,omitempty"`
+	Template string            `json:"template,omitempty"`
+	Options  map[string]string `json:"options,omitempty"`
+}
+
+// DigestSettings 是账号对日报 / 周报的选择，未设置时按 digest.daily / digest.weekly
+type DigestSettings struct {
+	Daily  bool `json:"daily"`
+	Weekly bool `json:"weekly"`
+}
+
+// QuietHours 是账号的免打扰时段（HH:MM，开始晚于结束表示跨午夜），时段内除二维码签到提醒外的通知会合并到结束时发送
+type QuietHours struct {
+	Enabled  bool   `json:"enabled"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone,omitempty"` // 留空为 digest.timezone
+}
+
+// AccountSettings 是单个账号（按邮箱区分，OpenID 会频繁更换）的个性化设置
+type AccountSettings struct {
+	Email      string             `json:"email"`
+	Escalation EscalationSettings `json:"escalation"`
+	Channels   []NotifyChannel    `json:"channels"`         // 为空时默认用账号邮箱发邮件
+	Digest     *DigestSettings    `json:"digest,omitempty"` // 为空时按全局配置
+	QuietHours QuietHours         `json:"quietHours"`
+}
+
+var accountMu sync.Mutex
+
+func accountSettingsPath() string {
+	return filepath.Join(overrideDir, accountSettingsFile)
+}
+
+// NormalizeEmail 统一邮箱大小写与空白，作为账号设置的键
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func readAccountSettings() (map[string]AccountSettings, error) {
+	path := accountSettingsPath()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]AccountSettings{}, nil
+		}
+		return nil, err
+	}
+	all := map[string]AccountSettings{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return all, nil
+}
+
+func normalizeAccountSettings(s *AccountSettings) {
+	s.Email = NormalizeEmail(s.Email)
+	s.Escalation.SecondaryEmail = strings.TrimSpace(s.Escalation.SecondaryEmail)
+	s.QuietHours.Start = strings.TrimSpace(s.QuietHours.Start)
+	s.QuietHours.End = strings.TrimSpace(s.QuietHours.End)
+	s.QuietHours.Timezone = strings.TrimSpace(s.QuietHours.Timezone)
+	buddies := make([]string, 0, len(s.Escalation.Buddies))
+	for _, b := range s.Escalation.Buddies {
+		if b = NormalizeEmail(b); b != "" && b != s.Email {
+			buddies = append(buddies, b)
+		}
+	}
+	s.Escalation.Buddies = buddies
+
+	channels := make([]NotifyChannel, 0, len(s.Channels))
+	for i, ch := range s.Channels {
+		ch.Type = strings.ToLower(strings.TrimSpace(ch.Type))
+		ch.ID = strings.TrimSpace(ch.ID)
+		ch.Target = strings.TrimSpace(ch.Target)
+		if ch.Type == "" {
+			continue
+		}
+		if ch.ID == "" {
+			ch.ID = ch.Type
+			if i > 0 {
+				ch.ID = fmt.Sprintf("%s-%d", ch.Type, i+1)
+			}
+		}
+		channels = append(channels, ch)
+	}
+	s.Channels = channels
+}
+
+// GetAccountSettings 返回邮箱对应的设置，不存在时返回空设置
+func GetAccountSettings(email string) (AccountSettings, error) {
+	accountMu.Lock()
+	defer accountMu.Unlock()
+
+	all, err := readAccountSettings()
+	if err != nil {
+		return AccountSettings{}, err
+	}
+	s, ok := all[NormalizeEmail(email)]
+	if !ok {
+		s = AccountSettings{Email: NormalizeEmail(email)}
+	}
+	normalizeAccountSettings(&s)
+	return s, nil
+}
+
+// ListAccountSettings 返回全部账号设置，按邮箱排序
+func ListAccountSettings() ([]AccountSettings, error) {
+	accountMu.Lock()
+	defer accountMu.Unlock()
+
+	all, err := readAccountSettings()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AccountSettings, 0, len(all))
+	for _, s := range all {
+		normalizeAccountSettings(&s)
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Email < out[j].Email })
+	return out, nil
+}
+
+func UpdateAccountSettings(s AccountSettings) (AccountSettings, error) {
+	normalizeAccountSettings(&s)
+	if s.Email == "" {
+		return AccountSettings{}, errors.New("email is required")
+	}
+
+	accountMu.Lock()
+	defer accountMu.Unlock()
+
+	all, err := readAccountSettings()
+	if err != nil {
+		return AccountSettings{}, err
+	}
+	all[s.Email] = s
+
+	if err := os.MkdirAll(overrideDir, 0o755); err != nil {
+		return AccountSettings{}, fmt.Errorf("mkdir %s: %w", overrideDir, err)
+	}
+	path := accountSettingsPath()
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return AccountSettings{}, fmt.Errorf("marshal %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return AccountSettings{}, fmt.Errorf("write %s: %w", path, err)
+	}
+	return s, nil
+}
@@ -29,6 +29,11 @@ type MailConfig struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	From     string `json:"from"`
+
+	Security           string `json:"security"`             // ssl / starttls / none，留空时 465 端口用 ssl，其它端口尽量升级 STARTTLS
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // 不校验服务器证书（内网中继、自签名证书）
+	Helo               string `json:"helo"`                 // HELO/EHLO 使用的主机名，留空为 localhost
+	Auth               string `json:"auth"`                 // plain / login / cram-md5 / none，留空按服务器支持自动选择
 }
 
 type AppConfigForUI struct {
@@ -40,6 +45,7 @@ type AppConfigForUI struct {
 type Secrets struct {
 	RedisPassword string `json:"redisPassword"`
 	MailPassword  string `json:"mailPassword"`
+	TelegramToken string `json:"telegramToken,omitempty"`
 }
 
 var (
@@ -63,6 +69,37 @@ func Load() error {
 		viper.SetDefault("mail.username", "")
 		viper.SetDefault("mail.password", "")
 		viper.SetDefault("mail.from", "")
+		viper.SetDefault("mail.security", "")
+		viper.SetDefault("mail.insecure_skip_verify", false)
+		viper.SetDefault("mail.helo", "")
+		viper.SetDefault("mail.auth", "")
+		viper.SetDefault("mail.locale", "zh-CN")
+		viper.SetDefault("mail.queue.workers", 2)
+		viper.SetDefault("mail.queue.max_attempts", 5)
+		viper.SetDefault("mail.queue.retry_base_seconds", 30)
+		viper.SetDefault("mail.queue.per_recipient_per_minute", 10)
+		viper.SetDefault("history.retention_days", 90)
+		viper.SetDefault("qr.max_lifetime_minutes", 15)
+		viper.SetDefault("qr.viewer_grace_seconds", 60)
+		viper.SetDefault("qr.transports", []string{"websocket", "long-polling"})
+		viper.SetDefault("qr.group_window_seconds", 5)
+		viper.SetDefault("qr.audit.keep", 50)
+		viper.SetDefault("telegram.enabled", false)
+		viper.SetDefault("telegram.token", "")
+		viper.SetDefault("telegram.api_base", "https://api.telegram.org")
+		viper.SetDefault("telegram.poll_timeout", 30)
+		viper.SetDefault("webpush.subject", "")
+		viper.SetDefault("qr.image.size", 320)
+		viper.SetDefault("qr.image.level", "M")
+		viper.SetDefault("qr.image.margin", 4)
+		viper.SetDefault("history.max_entries", 50000)
+		viper.SetDefault("digest.enabled", false)
+		viper.SetDefault("digest.time", "21:00")
+		viper.SetDefault("digest.timezone", "Asia/Shanghai")
+		viper.SetDefault("digest.weekly_day", "sunday")
+		viper.SetDefault("digest.daily", true)
+		viper.SetDefault("digest.weekly", false)
+		viper.SetDefault("digest.skip_empty", true)
 
 		// First-run bootstrap (so a fresh clone can save settings immediately)
 		if err := ensureLocalFiles(); err != nil {
@@ -270,6 +307,11 @@ func GetForUI() (AppConfigForUI, error) {
 			Username: viper.GetString("mail.username"),
 			Password: "", // never echo
 			From:     viper.GetString("mail.from"),
+
+			Security:           viper.GetString("mail.security"),
+			InsecureSkipVerify: viper.GetBool("mail.insecure_skip_verify"),
+			Helo:               viper.GetString("mail.helo"),
+			Auth:               viper.GetString("mail.auth"),
 		},
 		PasswordSet: viper.GetString("mail.password") != "",
 	}
@@ -335,12 +377,22 @@ func applyToViper(cfg AppConfig) {
 	if cfg.Mail.From != "" {
 		viper.Set("mail.from", cfg.Mail.From)
 	}
+	// 以下留空有意义（自动选择），总是覆盖
+	viper.Set("mail.security", cfg.Mail.Security)
+	viper.Set("mail.insecure_skip_verify", cfg.Mail.InsecureSkipVerify)
+	viper.Set("mail.helo", cfg.Mail.Helo)
+	viper.Set("mail.auth", cfg.Mail.Auth)
 }
 
 func overridesPath() string {
 	return filepath.Join(overrideDir, overrideFile)
 }
 
+// TemplatesDir 是覆盖内置通知模板的目录（data/templates）
+func TemplatesDir() string {
+	return filepath.Join(overrideDir, "templates")
+}
+
 func secretsPath() string {
 	return filepath.Join(overrideDir, secretsFile)
 }
@@ -380,6 +432,9 @@ func applySecretsToViper(s Secrets) {
 	if strings.TrimSpace(s.MailPassword) != "" {
 		viper.Set("mail.password", strings.TrimSpace(s.MailPassword))
 	}
+	if strings.TrimSpace(s.TelegramToken) != "" {
+		viper.Set("telegram.token", strings.TrimSpace(s.TelegramToken))
+	}
 }
 
 func readOverrides() (AppConfig, error) {
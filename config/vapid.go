@@ -0,0 +1,112 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const vapidFile = "vapid.json"
+
+// VAPIDKeys 是 Web Push 使用的服务器密钥对，首次使用时生成并保存在 data/vapid.json。
+// 更换密钥会使浏览器已有的订阅全部失效。
+type VAPIDKeys struct {
+	PublicKey  string `json:"publicKey"`  // 未压缩公钥，base64url，前端订阅时作为 applicationServerKey
+	PrivateKey string `json:"privateKey"` // PKCS#8 私钥，base64
+}
+
+var (
+	vapidMu   sync.Mutex
+	vapidKeys *VAPIDKeys
+)
+
+func vapidPath() string {
+	return filepath.Join(overrideDir, vapidFile)
+}
+
+// GetVAPIDKeys 读取 VAPID 密钥，不存在时生成新的密钥对
+func GetVAPIDKeys() (VAPIDKeys, error) {
+	vapidMu.Lock()
+	defer vapidMu.Unlock()
+
+	if vapidKeys != nil {
+		return *vapidKeys, nil
+	}
+	path := vapidPath()
+	b, err := os.ReadFile(path)
+	if err == nil {
+		var k VAPIDKeys
+		if err := json.Unmarshal(b, &k); err != nil {
+			return VAPIDKeys{}, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if _, err := k.ECDSA(); err != nil {
+			return VAPIDKeys{}, fmt.Errorf("parse %s: %w", path, err)
+		}
+		vapidKeys = &k
+		return k, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return VAPIDKeys{}, err
+	}
+
+	k, err := generateVAPIDKeys()
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	if err := os.MkdirAll(overrideDir, 0o755); err != nil {
+		return VAPIDKeys{}, fmt.Errorf("mkdir %s: %w", overrideDir, err)
+	}
+	b, err = json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return VAPIDKeys{}, fmt.Errorf("marshal %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return VAPIDKeys{}, fmt.Errorf("write %s: %w", path, err)
+	}
+	vapidKeys = &k
+	return k, nil
+}
+
+func generateVAPIDKeys() (VAPIDKeys, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	pub, err := priv.PublicKey.ECDH()
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	return VAPIDKeys{
+		PublicKey:  base64.RawURLEncoding.EncodeToString(pub.Bytes()),
+		PrivateKey: base64.StdEncoding.EncodeToString(der),
+	}, nil
+}
+
+// ECDSA 解析私钥，用于给 VAPID JWT 签名
+func (k VAPIDKeys) ECDSA() (*ecdsa.PrivateKey, error) {
+	der, err := base64.StdEncoding.DecodeString(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(*ecdsa.PrivateKey)
+	if !ok || priv.Curve != elliptic.P256() {
+		return nil, errors.New("VAPID key must be a P-256 ECDSA key")
+	}
+	return priv, nil
+}
@@ -83,3 +83,85 @@ func RedisRPop(key string) *redis.StringCmd {
 func RedisLTrim(key string, start, stop int64) *redis.StatusCmd {
 	return redisClient.LTrim(ctx, key, start, stop)
 }
+
+func RedisXAdd(args *redis.XAddArgs) *redis.StringCmd {
+	return redisClient.XAdd(ctx, args)
+}
+
+func RedisXTrimMinIDApprox(key string, minID string) *redis.IntCmd {
+	return redisClient.XTrimMinIDApprox(ctx, key, minID, 0)
+}
+
+func RedisXRangeN(key, start, stop string, count int64) *redis.XMessageSliceCmd {
+	return redisClient.XRangeN(ctx, key, start, stop, count)
+}
+
+func RedisXRevRangeN(key, start, stop string, count int64) *redis.XMessageSliceCmd {
+	return redisClient.XRevRangeN(ctx, key, start, stop, count)
+}
+
+// 阻塞读取，Block 为 0 时会一直等待，调用方应设置超时
+func RedisXRead(args *redis.XReadArgs) *redis.XStreamSliceCmd {
+	return redisClient.XRead(ctx, args)
+}
+
+func RedisSAdd(key string, members ...interface{}) *redis.IntCmd {
+	return redisClient.SAdd(ctx, key, members...)
+}
+
+func RedisSMembers(key string) *redis.StringSliceCmd {
+	return redisClient.SMembers(ctx, key)
+}
+
+func RedisSIsMember(key string, member interface{}) *redis.BoolCmd {
+	return redisClient.SIsMember(ctx, key, member)
+}
+
+func RedisRPush(key string, values ...interface{}) *redis.IntCmd {
+	return redisClient.RPush(ctx, key, values...)
+}
+
+func RedisLRange(key string, start, stop int64) *redis.StringSliceCmd {
+	return redisClient.LRange(ctx, key, start, stop)
+}
+
+func RedisTTL(key string) *redis.DurationCmd {
+	return redisClient.TTL(ctx, key)
+}
+
+// 阻塞弹出，超时返回 redis.Nil
+func RedisBLPop(timeout time.Duration, keys ...string) *redis.StringSliceCmd {
+	return redisClient.BLPop(ctx, timeout, keys...)
+}
+
+func RedisLLen(key string) *redis.IntCmd {
+	return redisClient.LLen(ctx, key)
+}
+
+func RedisLRem(key string, count int64, value interface{}) *redis.IntCmd {
+	return redisClient.LRem(ctx, key, count, value)
+}
+
+func RedisIncr(key string) *redis.IntCmd {
+	return redisClient.Incr(ctx, key)
+}
+
+func RedisZAdd(key string, members ...*redis.Z) *redis.IntCmd {
+	return redisClient.ZAdd(ctx, key, members...)
+}
+
+func RedisZRangeByScore(key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	return redisClient.ZRangeByScore(ctx, key, opt)
+}
+
+func RedisZRem(key string, members ...interface{}) *redis.IntCmd {
+	return redisClient.ZRem(ctx, key, members...)
+}
+
+func RedisZCard(key string) *redis.IntCmd {
+	return redisClient.ZCard(ctx, key)
+}
+
+func RedisRename(key, newKey string) *redis.StatusCmd {
+	return redisClient.Rename(ctx, key, newKey)
+}
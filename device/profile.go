@@ -0,0 +1,147 @@
+package device
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/db"
+)
+
+// Profile 是一组出站请求头（设备指纹），轮询、签到和 Faye 握手都用它伪装成同一台设备。
+type Profile struct {
+	Name           string            `json:"name" mapstructure:"name"`
+	UserAgent      string            `json:"userAgent" mapstructure:"user_agent"`
+	AcceptLanguage string            `json:"acceptLanguage" mapstructure:"accept_language"`
+	Referer        string            `json:"referer" mapstructure:"referer"`
+	Origin         string            `json:"origin" mapstructure:"origin"`
+	XRequestedWith string            `json:"xRequestedWith" mapstructure:"x_requested_with"`
+	Headers        map[string]string `json:"headers" mapstructure:"headers"`
+}
+
+const DefaultName = "wechat-android"
+
+// 内置档案：默认模拟安卓微信内置浏览器；edge-desktop 保留旧版硬编码的桌面 UA
+var builtin = []Profile{
+	{
+		Name:           "wechat-android",
+		UserAgent:      "Mozilla/5.0 (Linux; Android 13; M2012K11AC Build/TKQ1.220829.002; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/116.0.0.0 Mobile Safari/537.36 XWEB/1160065 MMWEBSDK/20231202 MMWEBID/2247 MicroMessenger/8.0.47.2560(0x28002F30) WeChat/arm64 Weixin NetType/WIFI Language/zh_CN ABI/arm64",
+		AcceptLanguage: "zh-CN,zh;q=0.9,en-US;q=0.8,en;q=0.7",
+		Referer:        "https://v18.teachermate.cn/wechat-pro-ssr/student/sign",
+		Origin:         "https://v18.teachermate.cn",
+		XRequestedWith: "com.tencent.mm",
+	},
+	{
+		Name:           "wechat-ios",
+		UserAgent:      "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 MicroMessenger/8.0.47(0x18002f2c) NetType/WIFI Language/zh_CN",
+		AcceptLanguage: "zh-CN,zh-Hans;q=0.9",
+		Referer:        "https://v18.teachermate.cn/wechat-pro-ssr/student/sign",
+		Origin:         "https://v18.teachermate.cn",
+	},
+	{
+		Name:      "edge-desktop",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36 Edg/122.0.0.0",
+	},
+}
+
+// List 返回全部可用档案：内置档案在前，config.yml 中 device.profiles 的同名档案会覆盖内置档案
+func List() []Profile {
+	out := make([]Profile, 0, len(builtin))
+	out = append(out, builtin...)
+
+	var custom []Profile
+	if err := viper.UnmarshalKey("device.profiles", &custom); err != nil {
+		log.Println("Error parsing device.profiles:", err)
+		return out
+	}
+	for _, p := range custom {
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" {
+			continue
+		}
+		replaced := false
+		for i := range out {
+			if out[i].Name == p.Name {
+				out[i] = p
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func Get(name string) (Profile, bool) {
+	name = strings.TrimSpace(name)
+	for _, p := range List() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Default 返回 device.default 指定的档案，未配置或不存在时回退到安卓微信
+func Default() Profile {
+	if p, ok := Get(viper.GetString("device.default")); ok {
+		return p
+	}
+	p, _ := Get(DefaultName)
+	return p
+}
+
+// ForOpenId 返回该 OpenID 分配的档案（wzj:device:<openId>），未分配时使用默认档案
+func ForOpenId(openId string) Profile {
+	name, err := db.RedisGet("wzj:device:" + openId).Result()
+	if err == nil {
+		if p, ok := Get(name); ok {
+			return p
+		}
+	}
+	return Default()
+}
+
+// Assign 为 OpenID 分配档案，name 为空时清除分配（0 表示永不过期，与 wzj:gps 一致）
+func Assign(openId string, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return db.RedisDel("wzj:device:" + openId).Err()
+	}
+	return db.RedisSet("wzj:device:"+openId, name, 0).Err()
+}
+
+// Apply 把档案中的请求头写入 h，空字段不写
+func (p Profile) Apply(h http.Header) {
+	set := func(key, value string) {
+		if strings.TrimSpace(value) != "" {
+			h.Set(key, value)
+		}
+	}
+	set("User-Agent", p.UserAgent)
+	set("Accept-Language", p.AcceptLanguage)
+	set("Referer", p.Referer)
+	set("Origin", p.Origin)
+	set("X-Requested-With", p.XRequestedWith)
+	for k, v := range p.Headers {
+		set(k, v)
+	}
+}
+
+// Header 返回用于 websocket 握手的请求头。
+// Faye 服务在 www.teachermate.com.cn，因此 Origin 与 Referer 改用该域名。
+func (p Profile) Header() http.Header {
+	h := http.Header{}
+	p.Apply(h)
+	if p.Origin != "" {
+		h.Set("Origin", "https://www.teachermate.com.cn")
+	}
+	if h.Get("Referer") != "" {
+		h.Set("Referer", "https://www.teachermate.com.cn/")
+	}
+	return h
+}
@@ -0,0 +1,158 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var csvHeader = []string{"time", "type", "openId", "courseName", "courseId", "signId", "mode", "result", "reason", "signRank", "studentRank"}
+
+// eventSource 依次把事件交给 fn，导出时为 Range，测试时可以直接提供事件
+type eventSource func(fn func(Event) error) error
+
+func rangeSource(f Filter) eventSource {
+	return func(fn func(Event) error) error { return Range(f, fn) }
+}
+
+// WriteCSV 导出签到历史为 CSV（带 UTF-8 BOM，Excel 打开中文不乱码）
+func WriteCSV(w io.Writer, f Filter) error {
+	return writeCSV(w, rangeSource(f))
+}
+
+func writeCSV(w io.Writer, events eventSource) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	err := events(func(e Event) error {
+		return cw.Write([]string{
+			e.Time.Format(time.RFC3339),
+			e.Type,
+			e.OpenId,
+			e.CourseName,
+			itoa(e.CourseId),
+			itoa(e.SignId),
+			e.Mode,
+			e.Result,
+			e.Reason,
+			itoa(e.SignRank),
+			itoa(e.StudentRank),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSONL 导出签到历史为 JSON Lines，每行一条完整事件
+func WriteJSONL(w io.Writer, f Filter) error {
+	return writeJSONL(w, rangeSource(f))
+}
+
+func writeJSONL(w io.Writer, events eventSource) error {
+	enc := json.NewEncoder(w)
+	return events(func(e Event) error {
+		return enc.Encode(e)
+	})
+}
+
+// WriteICS 把检测到的签到导出为 iCalendar，日历应用可订阅。
+// 同一 OpenID 的同一签到只生成一个 VEVENT，持续时间 duration。
+func WriteICS(w io.Writer, f Filter, name string, duration time.Duration) error {
+	f.Type = TypeDetected
+	return writeICS(w, rangeSource(f), name, duration)
+}
+
+func writeICS(w io.Writer, events eventSource, name string, duration time.Duration) error {
+	seen := map[string]bool{}
+
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	b.WriteString("VERSION:2.0\r\n")
+	b.WriteString("PRODID:-//wzj_signin//sign history//ZH\r\n")
+	b.WriteString("CALSCALE:GREGORIAN\r\n")
+	b.WriteString("METHOD:PUBLISH\r\n")
+	writeICSLine(&b, "X-WR-CALNAME:"+icsEscape(name))
+
+	err := events(func(e Event) error {
+		uid := fmt.Sprintf("%s-%d-%d@wzj_signin", e.OpenId, e.CourseId, e.SignId)
+		if seen[uid] {
+			return nil
+		}
+		seen[uid] = true
+
+		summary := e.CourseName
+		if summary == "" {
+			summary = "课程 " + itoa(e.CourseId)
+		}
+		summary += " · " + modeLabel(e.Mode)
+
+		b.WriteString("BEGIN:VEVENT\r\n")
+		writeICSLine(&b, "UID:"+uid)
+		writeICSLine(&b, "DTSTAMP:"+icsTime(e.Time))
+		writeICSLine(&b, "DTSTART:"+icsTime(e.Time))
+		writeICSLine(&b, "DTEND:"+icsTime(e.Time.Add(duration)))
+		writeICSLine(&b, "SUMMARY:"+icsEscape(summary))
+		writeICSLine(&b, "DESCRIPTION:"+icsEscape(fmt.Sprintf("courseId: %d\nsignId: %d\nopenId: %s", e.CourseId, e.SignId, e.OpenId)))
+		b.WriteString("END:VEVENT\r\n")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func modeLabel(mode string) string {
+	switch mode {
+	case "qr":
+		return "二维码签到"
+	case "gps":
+		return "GPS 签到"
+	default:
+		return "普通签到"
+	}
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func icsEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// RFC 5545：每行不超过 75 字节，续行以空格开头（按 rune 切分，避免截断中文）
+func writeICSLine(b *strings.Builder, line string) {
+	n := 0
+	for _, r := range line {
+		size := len(string(r))
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	b.WriteString("\r\n")
+}
+
+func itoa(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,127 @@
+package history
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func exportEvents() eventSource {
+	cst := time.FixedZone("CST", 8*3600)
+	events := []Event{
+		{ID: "1709253000000-0", Time: time.Date(2024, 3, 1, 8, 30, 0, 0, cst), Type: TypeAttempt, OpenId: "oid1", CourseId: 12, SignId: 34,
+			CourseName: `高数, "A"`, Mode: "gps", Result: ResultSuccess, SignRank: 5, StudentRank: 3, DelayMs: 1500},
+		{Time: time.Date(2024, 3, 1, 8, 29, 0, 0, time.UTC), Type: TypeDetected, OpenId: "oid1", CourseId: 12, SignId: 34, Mode: "qr"},
+	}
+	return func(fn func(Event) error) error {
+		for _, e := range events {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeCSV(&b, exportEvents()); err != nil {
+		t.Fatal(err)
+	}
+	want := "\ufeff" + `time,type,openId,courseName,courseId,signId,mode,result,reason,signRank,studentRank
+2024-03-01T08:30:00+08:00,attempt,oid1,"高数, ""A""",12,34,gps,success,,5,3
+2024-03-01T08:29:00Z,detected,oid1,,12,34,qr,,,,
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeJSONL(&b, exportEvents()); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":"1709253000000-0","time":"2024-03-01T08:30:00+08:00","type":"attempt","openId":"oid1","courseId":12,"signId":34,"courseName":"高数, \"A\"","mode":"gps","result":"success","signRank":5,"studentRank":3,"delayMs":1500}
+{"id":"","time":"2024-03-01T08:29:00Z","type":"detected","openId":"oid1","courseId":12,"signId":34,"mode":"qr"}
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	var b bytes.Buffer
+	// 同一 OpenID 的同一签到只导出一次，以第一条为准
+	if err := writeICS(&b, exportEvents(), "微助教签到", 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//wzj_signin//sign history//ZH",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:微助教签到",
+		"BEGIN:VEVENT",
+		"UID:oid1-12-34@wzj_signin",
+		"DTSTAMP:20240301T003000Z",
+		"DTSTART:20240301T003000Z",
+		"DTEND:20240301T004000Z",
+		`SUMMARY:高数\, "A" · GPS 签到`,
+		`DESCRIPTION:courseId: 12\nsignId: 34\nopenId: oid1`,
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestICSEscape(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain", "plain"},
+		{"a;b,c", `a\;b\,c`},
+		{`back\slash`, `back\\slash`},
+		{"two\nlines", `two\nlines`},
+		{`\;`, `\\\;`},
+	}
+	for _, tt := range tests {
+		if got := icsEscape(tt.in); got != tt.want {
+			t.Errorf("icsEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteICSLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short", "SUMMARY:abc", "SUMMARY:abc\r\n"},
+		{"exactly 75 bytes", strings.Repeat("a", 75), strings.Repeat("a", 75) + "\r\n"},
+		{"76 bytes", strings.Repeat("a", 76), strings.Repeat("a", 75) + "\r\n a\r\n"},
+		// 25 个汉字正好 75 字节；续行以空格开头，之后每行最多 24 个汉字
+		{"cjk", strings.Repeat("签", 50), strings.Repeat("签", 25) + "\r\n " + strings.Repeat("签", 24) + "\r\n 签\r\n"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		writeICSLine(&b, tt.line)
+		got := b.String()
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		for _, physical := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+			if len(physical) > 75 || !utf8.ValidString(physical) {
+				t.Errorf("%s: bad folded line %q", tt.name, physical)
+			}
+		}
+		if unfolded := strings.ReplaceAll(strings.TrimSuffix(got, "\r\n"), "\r\n ", ""); unfolded != tt.line {
+			t.Errorf("%s: unfolded %q, want %q", tt.name, unfolded, tt.line)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+
+	"wzj_signin/db"
+)
+
+// 服务端签到历史：只追加的 Redis Stream，ID 即时间顺序，保留策略见 history.retention_days / history.max_entries
+const StreamKey = "wzj:history"
+
+// 事件类型
+const (
+	TypeDetected  = "detected"  // 轮询发现了一个签到
+	TypeAttempt   = "attempt"   // 提交了一次签到请求
+	TypeExpired   = "expired"   // OpenID 失效
+	TypeCompleted = "completed" // 二维码签到结束：用户确认完成为 success，签到直接关闭为 missed
+)
+
+// 签到结果
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+	ResultMissed  = "missed" // 二维码签到关闭前没有确认扫码
+)
+
+type Event struct {
+	ID          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	OpenId      string    `json:"openId"`
+	Email       string    `json:"email,omitempty"` // 记录时绑定的邮箱，OpenID 失效或过期后仍能归属到账号
+	CourseId    int       `json:"courseId,omitempty"`
+	SignId      int       `json:"signId,omitempty"`
+	CourseName  string    `json:"courseName,omitempty"`
+	Mode        string    `json:"mode,omitempty"`   // normal / gps / qr
+	Result      string    `json:"result,omitempty"` // success / failed（仅 attempt）
+	Reason      string    `json:"reason,omitempty"` // 失败原因分类，如 network / rejected / openid_expired
+	Message     string    `json:"message,omitempty"`
+	Lat         float64   `json:"lat,omitempty"`
+	Lon         float64   `json:"lon,omitempty"`
+	SignRank    int       `json:"signRank,omitempty"`
+	StudentRank int       `json:"studentRank,omitempty"`
+	PollMs      int64     `json:"pollMs,omitempty"`     // 发现该签到的那次轮询耗时
+	DelayMs     int64     `json:"delayMs,omitempty"`    // 从发现到提交的等待时间
+	ResponseMs  int64     `json:"responseMs,omitempty"` // 签到请求耗时
+}
+
+// Record 追加一条历史事件，失败只记录日志，不影响签到流程
+func Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Println("Error marshaling history event:", err)
+		return
+	}
+
+	args := &redis.XAddArgs{
+		Stream: StreamKey,
+		Values: map[string]interface{}{"data": string(b)},
+	}
+	if maxEntries := viper.GetInt64("history.max_entries"); maxEntries > 0 {
+		args.MaxLen = maxEntries
+		args.Approx = true
+	}
+	if err := db.RedisXAdd(args).Err(); err != nil {
+		log.Println("Error recording history event:", err)
+		return
+	}
+
+	if days := viper.GetInt("history.retention_days"); days > 0 {
+		minID := strconv.FormatInt(time.Now().AddDate(0, 0, -days).UnixMilli(), 10)
+		_ = db.RedisXTrimMinIDApprox(StreamKey, minID).Err()
+	}
+}
+
+// Filter 描述 /api/history 的查询条件，零值字段表示不过滤
+type Filter struct {
+	OpenIds  []string
+	CourseId int
+	SignId   int
+	Type     string
+	Mode     string
+	Result   string
+	From     time.Time
+	To       time.Time
+}
+
+func (f Filter) Match(e Event) bool {
+	if len(f.OpenIds) > 0 {
+		found := false
+		for _, id := range f.OpenIds {
+			if id == e.OpenId {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.CourseId != 0 && e.CourseId != f.CourseId {
+		return false
+	}
+	if f.SignId != 0 && e.SignId != f.SignId {
+		return false
+	}
+	if f.Type != "" && e.Type != f.Type {
+		return false
+	}
+	if f.Mode != "" && e.Mode != f.Mode {
+		return false
+	}
+	if f.Result != "" && e.Result != f.Result {
+		return false
+	}
+	return true
+}
+
+// Query 按时间倒序返回最多 limit 条匹配事件。
+// cursor 为上一页最后一条事件的 ID（不包含），返回的 next 为空表示没有更多数据。
+func Query(f Filter, cursor string, limit int) (events []Event, next string, err error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	end := "+"
+	if !f.To.IsZero() {
+		end = strconv.FormatInt(f.To.UnixMilli(), 10)
+	}
+	if cursor = strings.TrimSpace(cursor); cursor != "" {
+		end = "(" + cursor
+	}
+	start := "-"
+	if !f.From.IsZero() {
+		start = strconv.FormatInt(f.From.UnixMilli(), 10)
+	}
+
+	const batch = 200
+	events = []Event{}
+	for {
+		msgs, err := db.RedisXRevRangeN(StreamKey, end, start, batch).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		for _, msg := range msgs {
+			e, ok := decode(msg)
+			if !ok || !f.Match(e) {
+				continue
+			}
+			events = append(events, e)
+			if len(events) == limit {
+				return events, e.ID, nil
+			}
+		}
+		if len(msgs) < batch {
+			return events, "", nil
+		}
+		end = "(" + msgs[len(msgs)-1].ID
+	}
+}
+
+// Range 按时间正序遍历 [from, to] 内匹配的全部事件（用于统计/导出）
+func Range(f Filter, fn func(Event) error) error {
+	start := "-"
+	if !f.From.IsZero() {
+		start = strconv.FormatInt(f.From.UnixMilli(), 10)
+	}
+	end := "+"
+	if !f.To.IsZero() {
+		end = strconv.FormatInt(f.To.UnixMilli(), 10)
+	}
+
+	const batch = 500
+	for {
+		msgs, err := db.RedisXRangeN(StreamKey, start, end, batch).Result()
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			e, ok := decode(msg)
+			if !ok || !f.Match(e) {
+				continue
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if len(msgs) < batch {
+			return nil
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+}
+
+func decode(msg redis.XMessage) (Event, bool) {
+	raw, _ := msg.Values["data"].(string)
+	var e Event
+	if err := json.Unmarshal([]byte(raw), &e); err != nil {
+		log.Println("Error parsing history event", msg.ID, ":", err)
+		return Event{}, false
+	}
+	e.ID = msg.ID
+	return e, true
+}
+
+// ParseTime 解析查询参数中的时间：RFC3339、2006-01-02 或 Unix 秒
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间：%s", s)
+}
+
+// ParseEndTime 解析查询的结束时间（包含）。只有日期时表示当天结束，
+// 即次日零点前的最后一毫秒，否则 to=2024-03-01 会把当天的记录全部排除。
+func ParseEndTime(s string) (time.Time, error) {
+	t, err := ParseTime(s)
+	if err != nil || t.IsZero() {
+		return t, err
+	}
+	if _, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(s), time.Local); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Millisecond), nil
+	}
+	return t, nil
+}
@@ -0,0 +1,108 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "", want: time.Time{}},
+		{in: "  ", want: time.Time{}},
+		{in: "2024-03-01T08:30:00+08:00", want: time.Date(2024, 3, 1, 8, 30, 0, 0, time.FixedZone("", 8*3600))},
+		{in: "2024-03-01T00:30:00Z", want: time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC)},
+		{in: "2024-03-01", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)},
+		{in: " 2024-03-01 ", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)},
+		{in: "1709251200", want: time.Unix(1709251200, 0)},
+		{in: "2024/03/01", wantErr: true},
+		{in: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseEndTime(t *testing.T) {
+	endOfDay := time.Date(2024, 3, 1, 23, 59, 59, int(999*time.Millisecond), time.Local)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "", want: time.Time{}},
+		{in: "2024-03-01", want: endOfDay},
+		{in: "2024-02-29", want: time.Date(2024, 2, 29, 23, 59, 59, int(999*time.Millisecond), time.Local)},
+		{in: "2024-03-01T08:30:00+08:00", want: time.Date(2024, 3, 1, 8, 30, 0, 0, time.FixedZone("", 8*3600))},
+		{in: "1709251200", want: time.Unix(1709251200, 0)},
+		{in: "nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEndTime(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseEndTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseEndTime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// 只有日期的结束时间包含当天最后一条记录，但不包含次日零点的记录（Range 按毫秒比较）
+func TestParseEndTimeIncludesWholeDay(t *testing.T) {
+	end, err := ParseEndTime("2024-03-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastOfDay := time.Date(2024, 3, 1, 23, 59, 59, int(999*time.Millisecond), time.Local)
+	nextDay := time.Date(2024, 3, 2, 0, 0, 0, 0, time.Local)
+	if lastOfDay.UnixMilli() > end.UnixMilli() {
+		t.Errorf("end %v excludes %v", end, lastOfDay)
+	}
+	if nextDay.UnixMilli() <= end.UnixMilli() {
+		t.Errorf("end %v includes %v", end, nextDay)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	e := Event{Type: TypeAttempt, OpenId: "a", CourseId: 1, SignId: 2, Mode: "gps", Result: ResultFailed}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"openId listed", Filter{OpenIds: []string{"b", "a"}}, true},
+		{"openId not listed", Filter{OpenIds: []string{"b"}}, false},
+		{"course", Filter{CourseId: 1}, true},
+		{"other course", Filter{CourseId: 3}, false},
+		{"sign", Filter{SignId: 2}, true},
+		{"other sign", Filter{SignId: 3}, false},
+		{"type", Filter{Type: TypeAttempt}, true},
+		{"other type", Filter{Type: TypeDetected}, false},
+		{"mode", Filter{Mode: "gps"}, true},
+		{"other mode", Filter{Mode: "qr"}, false},
+		{"result", Filter{Result: ResultFailed}, true},
+		{"other result", Filter{Result: ResultSuccess}, false},
+		{"all fields", Filter{OpenIds: []string{"a"}, CourseId: 1, SignId: 2, Type: TypeAttempt, Mode: "gps", Result: ResultFailed}, true},
+		{"one field off", Filter{OpenIds: []string{"a"}, CourseId: 1, SignId: 2, Type: TypeAttempt, Mode: "normal", Result: ResultFailed}, false},
+		// 时间范围由 Range / Query 按 Stream ID 过滤，Match 不检查
+		{"time bounds ignored", Filter{From: time.Unix(10, 0), To: time.Unix(20, 0)}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(e); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
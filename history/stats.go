@@ -0,0 +1,225 @@
+package history
+
+import "sort"
+
+// Stats 是一组签到历史的统计结果（按账号、按课程或合计）
+type Stats struct {
+	Detected         int            `json:"detected"`         // 发现的签到数（同一 OpenID 的同一签到只算一次）
+	AutoSigned       int            `json:"autoSigned"`       // 自动签到成功的签到数
+	Failed           int            `json:"failed"`           // 自动签到失败且之后没有成功的签到数
+	FailedAttempts   int            `json:"failedAttempts"`   // 失败的签到请求次数（同一签到的每次重试都算）
+	FailedByReason   map[string]int `json:"failedByReason"`   // 按原因分类、出现过该原因失败的签到数
+	QRDetected       int            `json:"qrDetected"`       // 二维码签到数
+	QRMissed         int            `json:"qrMissed"`         // 关闭前没有确认扫码（completed 为 missed）的二维码签到数
+	MedianPollMs     int64          `json:"medianPollMs"`     // 首次发现签到的那次轮询请求耗时中位数（接口不提供签到开始时间，不是发现延迟）
+	MedianDelayMs    int64          `json:"medianDelayMs"`    // 从发现到提交签到的等待时间中位数
+	RankDistribution map[string]int `json:"rankDistribution"` // StudentRank 分布
+}
+
+type AccountStats struct {
+	OpenId string `json:"openId"`
+	Stats
+}
+
+type CourseStats struct {
+	CourseId   int    `json:"courseId"`
+	CourseName string `json:"courseName"`
+	Stats
+}
+
+type Report struct {
+	Total    Stats          `json:"total"`
+	Accounts []AccountStats `json:"accounts"`
+	Courses  []CourseStats  `json:"courses"`
+}
+
+// 按 OpenID + signId 聚合一次签到的全部事件
+type signKey struct {
+	openId string
+	signId int
+}
+
+type signAgg struct {
+	mode      string
+	detected  bool
+	succeeded bool
+	missed    bool
+	reasons   map[string]bool // 出现过的失败原因
+}
+
+type statsAcc struct {
+	signs          map[signKey]*signAgg
+	failedAttempts int
+	pollMs         []int64
+	delayMs        []int64
+	ranks          map[string]int
+}
+
+func newAcc() *statsAcc {
+	return &statsAcc{signs: map[signKey]*signAgg{}, ranks: map[string]int{}}
+}
+
+func (a *statsAcc) add(e Event) {
+	k := signKey{e.OpenId, e.SignId}
+	s := a.signs[k]
+	if s == nil {
+		s = &signAgg{}
+		a.signs[k] = s
+	}
+	if e.Mode != "" {
+		s.mode = e.Mode
+	}
+
+	switch e.Type {
+	case TypeDetected:
+		// 失败后每个轮询周期都会再记录一次发现，只取第一次
+		if !s.detected && e.PollMs > 0 {
+			a.pollMs = append(a.pollMs, e.PollMs)
+		}
+		s.detected = true
+	case TypeAttempt:
+		if e.Result == ResultFailed {
+			a.failedAttempts++
+			reason := e.Reason
+			if reason == "" {
+				reason = "unknown"
+			}
+			if s.reasons == nil {
+				s.reasons = map[string]bool{}
+			}
+			s.reasons[reason] = true
+		}
+		if e.Result == ResultSuccess && !s.succeeded {
+			a.delayMs = append(a.delayMs, e.DelayMs)
+			if e.StudentRank > 0 {
+				a.ranks[rankBucket(e.StudentRank)]++
+			}
+		}
+	}
+	if e.Result == ResultSuccess {
+		s.succeeded = true
+	}
+	if e.Result == ResultMissed {
+		s.missed = true
+	}
+}
+
+func (a *statsAcc) result() Stats {
+	st := Stats{
+		FailedAttempts:   a.failedAttempts,
+		FailedByReason:   map[string]int{},
+		MedianPollMs:     median(a.pollMs),
+		MedianDelayMs:    median(a.delayMs),
+		RankDistribution: a.ranks,
+	}
+	for _, s := range a.signs {
+		for reason := range s.reasons {
+			st.FailedByReason[reason]++
+		}
+		if !s.detected && !s.succeeded {
+			continue
+		}
+		st.Detected++
+		if s.mode == "qr" {
+			st.QRDetected++
+			if s.missed && !s.succeeded {
+				st.QRMissed++
+			}
+			continue
+		}
+		if s.succeeded {
+			st.AutoSigned++
+		} else if len(s.reasons) > 0 {
+			st.Failed++
+		}
+	}
+	return st
+}
+
+// reportAcc 同时按合计、OpenID、课程累计事件
+type reportAcc struct {
+	total       *statsAcc
+	accounts    map[string]*statsAcc
+	courses     map[int]*statsAcc
+	courseNames map[int]string
+}
+
+func newReportAcc() *reportAcc {
+	return &reportAcc{total: newAcc(), accounts: map[string]*statsAcc{}, courses: map[int]*statsAcc{}, courseNames: map[int]string{}}
+}
+
+func (r *reportAcc) add(e Event) {
+	if e.Type != TypeDetected && e.Type != TypeAttempt && e.Result == "" {
+		return
+	}
+	r.total.add(e)
+	if r.accounts[e.OpenId] == nil {
+		r.accounts[e.OpenId] = newAcc()
+	}
+	r.accounts[e.OpenId].add(e)
+	if e.CourseId != 0 {
+		if r.courses[e.CourseId] == nil {
+			r.courses[e.CourseId] = newAcc()
+		}
+		r.courses[e.CourseId].add(e)
+		if e.CourseName != "" {
+			r.courseNames[e.CourseId] = e.CourseName
+		}
+	}
+}
+
+func (r *reportAcc) report() Report {
+	out := Report{Total: r.total.result(), Accounts: []AccountStats{}, Courses: []CourseStats{}}
+	for openId, acc := range r.accounts {
+		out.Accounts = append(out.Accounts, AccountStats{OpenId: openId, Stats: acc.result()})
+	}
+	for courseId, acc := range r.courses {
+		out.Courses = append(out.Courses, CourseStats{CourseId: courseId, CourseName: r.courseNames[courseId], Stats: acc.result()})
+	}
+	sort.Slice(out.Accounts, func(i, j int) bool { return out.Accounts[i].Detected > out.Accounts[j].Detected })
+	sort.Slice(out.Courses, func(i, j int) bool { return out.Courses[i].Detected > out.Courses[j].Detected })
+	return out
+}
+
+// Summarize 统计 f 范围内的签到历史，结果按 OpenID、课程分别汇总
+func Summarize(f Filter) (Report, error) {
+	acc := newReportAcc()
+	err := Range(f, func(e Event) error {
+		acc.add(e)
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return acc.report(), nil
+}
+
+func rankBucket(rank int) string {
+	switch {
+	case rank <= 1:
+		return "1"
+	case rank <= 5:
+		return "2-5"
+	case rank <= 10:
+		return "6-10"
+	case rank <= 20:
+		return "11-20"
+	case rank <= 50:
+		return "21-50"
+	default:
+		return "51+"
+	}
+}
+
+func median(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
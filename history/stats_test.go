@@ -0,0 +1,151 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+)
+
+func detected(openId string, signId int, mode string, pollMs int64) Event {
+	return Event{Type: TypeDetected, OpenId: openId, CourseId: 1, SignId: signId, Mode: mode, PollMs: pollMs}
+}
+
+func attempt(openId string, signId int, result string, reason string) Event {
+	return Event{Type: TypeAttempt, OpenId: openId, CourseId: 1, SignId: signId, Mode: "gps", Result: result, Reason: reason}
+}
+
+func TestStatsAccAdd(t *testing.T) {
+	signed := func(openId string, signId int, rank int, delayMs int64) Event {
+		e := attempt(openId, signId, ResultSuccess, "")
+		e.StudentRank, e.DelayMs = rank, delayMs
+		return e
+	}
+	completed := func(openId string, signId int, result string) Event {
+		return Event{Type: TypeCompleted, OpenId: openId, CourseId: 1, SignId: signId, Mode: "qr", Result: result}
+	}
+
+	tests := []struct {
+		name   string
+		events []Event
+		want   Stats
+	}{
+		{
+			name:   "repeat detection counts once",
+			events: []Event{detected("a", 1, "gps", 100), detected("a", 1, "gps", 900), detected("a", 1, "gps", 900)},
+			want:   Stats{Detected: 1, MedianPollMs: 100},
+		},
+		{
+			name:   "same sign for two accounts",
+			events: []Event{detected("a", 1, "gps", 100), detected("b", 1, "gps", 300)},
+			want:   Stats{Detected: 2, MedianPollMs: 200},
+		},
+		{
+			name: "failed then succeeded",
+			events: []Event{
+				detected("a", 1, "gps", 100),
+				attempt("a", 1, ResultFailed, "network"),
+				detected("a", 1, "gps", 100),
+				attempt("a", 1, ResultFailed, "network"),
+				signed("a", 1, 3, 2000),
+			},
+			want: Stats{Detected: 1, AutoSigned: 1, FailedAttempts: 2, FailedByReason: map[string]int{"network": 1},
+				MedianPollMs: 100, MedianDelayMs: 2000, RankDistribution: map[string]int{"2-5": 1}},
+		},
+		{
+			name: "failed on every poll",
+			events: []Event{
+				detected("a", 1, "gps", 100),
+				attempt("a", 1, ResultFailed, "rejected"),
+				attempt("a", 1, ResultFailed, "rejected"),
+				attempt("a", 1, ResultFailed, ""),
+			},
+			want: Stats{Detected: 1, Failed: 1, FailedAttempts: 3, FailedByReason: map[string]int{"rejected": 1, "unknown": 1}, MedianPollMs: 100},
+		},
+		{
+			name:   "qr missed via completed event",
+			events: []Event{detected("a", 2, "qr", 50), completed("a", 2, ResultMissed)},
+			want:   Stats{Detected: 1, QRDetected: 1, QRMissed: 1, MedianPollMs: 50},
+		},
+		{
+			name:   "qr confirmed",
+			events: []Event{detected("a", 2, "qr", 50), completed("a", 2, ResultSuccess)},
+			want:   Stats{Detected: 1, QRDetected: 1, MedianPollMs: 50},
+		},
+		{
+			name:   "qr still pending",
+			events: []Event{detected("a", 2, "qr", 50)},
+			want:   Stats{Detected: 1, QRDetected: 1, MedianPollMs: 50},
+		},
+		{
+			name: "rank buckets count the first success only",
+			events: []Event{
+				signed("a", 1, 1, 10), signed("a", 1, 1, 10),
+				signed("a", 2, 5, 20), signed("a", 3, 6, 30), signed("a", 4, 20, 40),
+				signed("a", 5, 21, 50), signed("a", 6, 51, 60), signed("a", 7, 0, 70),
+			},
+			want: Stats{Detected: 7, AutoSigned: 7, MedianDelayMs: 40,
+				RankDistribution: map[string]int{"1": 1, "2-5": 1, "6-10": 1, "11-20": 1, "21-50": 1, "51+": 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := newAcc()
+			for _, e := range tt.events {
+				acc.add(e)
+			}
+			want := tt.want
+			if want.FailedByReason == nil {
+				want.FailedByReason = map[string]int{}
+			}
+			if want.RankDistribution == nil {
+				want.RankDistribution = map[string]int{}
+			}
+			if got := acc.result(); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReportAcc(t *testing.T) {
+	r := newReportAcc()
+	for _, e := range []Event{
+		detected("a", 1, "gps", 100),
+		attempt("a", 1, ResultSuccess, ""),
+		detected("b", 1, "gps", 100),
+		attempt("b", 1, ResultFailed, "network"),
+		{Type: TypeDetected, OpenId: "a", CourseId: 2, CourseName: "线性代数", SignId: 3, Mode: "qr"},
+		{Type: TypeExpired, OpenId: "a"},
+	} {
+		r.add(e)
+	}
+	got := r.report()
+
+	if got.Total.Detected != 3 || got.Total.AutoSigned != 1 || got.Total.Failed != 1 || got.Total.QRDetected != 1 {
+		t.Errorf("total = %+v", got.Total)
+	}
+	if len(got.Accounts) != 2 || got.Accounts[0].OpenId != "a" || got.Accounts[0].Detected != 2 || got.Accounts[1].Failed != 1 {
+		t.Errorf("accounts = %+v", got.Accounts)
+	}
+	if len(got.Courses) != 2 || got.Courses[0].CourseId != 1 || got.Courses[0].Detected != 2 ||
+		got.Courses[1].CourseName != "线性代数" || got.Courses[1].QRDetected != 1 {
+		t.Errorf("courses = %+v", got.Courses)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []int64
+		want   int64
+	}{
+		{nil, 0},
+		{[]int64{5}, 5},
+		{[]int64{9, 1, 5}, 5},
+		{[]int64{4, 1, 3, 2}, 2},
+		{[]int64{10, 20}, 15},
+	}
+	for _, tt := range tests {
+		if got := median(tt.values); got != tt.want {
+			t.Errorf("median(%v) = %d, want %d", tt.values, got, tt.want)
+		}
+	}
+}
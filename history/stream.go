@@ -0,0 +1,147 @@
+package history
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"wzj_signin/db"
+)
+
+// 进程内只用一个 goroutine 阻塞读取 wzj:history，再分发给所有 SSE 订阅者，
+// 避免每个浏览器标签页都占用一个 Redis 连接。
+var (
+	hubOnce sync.Once
+	hubMu   sync.Mutex
+	subs    = map[chan Event]struct{}{}
+)
+
+// Subscribe 订阅新写入的历史事件。订阅者处理过慢时 channel 会被关闭，
+// 客户端应带上最后收到的 ID 重新订阅（见 Since）。
+func Subscribe() (<-chan Event, func()) {
+	hubOnce.Do(func() { go tail() })
+
+	ch := make(chan Event, 64)
+	hubMu.Lock()
+	subs[ch] = struct{}{}
+	hubMu.Unlock()
+
+	cancel := func() {
+		hubMu.Lock()
+		defer hubMu.Unlock()
+		if _, ok := subs[ch]; ok {
+			delete(subs, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+func broadcast(e Event) {
+	hubMu.Lock()
+	defer hubMu.Unlock()
+	for ch := range subs {
+		select {
+		case ch <- e:
+		default:
+			log.Println("History subscriber too slow, dropping it at", e.ID)
+			delete(subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func tail() {
+	lastID := "$"
+	for {
+		streams, err := db.RedisXRead(&redis.XReadArgs{
+			Streams: []string{StreamKey, lastID},
+			Count:   100,
+			Block:   10 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil {
+				log.Println("Error reading history stream:", err)
+				time.Sleep(2 * time.Second)
+			}
+			continue
+		}
+		for _, st := range streams {
+			for _, msg := range st.Messages {
+				lastID = msg.ID
+				if e, ok := decode(msg); ok {
+					broadcast(e)
+				}
+			}
+		}
+	}
+}
+
+// Since 返回 ID 大于 lastID 的匹配事件（按时间正序），用于断线重连后补发
+func Since(f Filter, lastID string, limit int) ([]Event, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	out := []Event{}
+	start := "(" + lastID
+	for len(out) < limit {
+		msgs, err := db.RedisXRangeN(StreamKey, start, "+", 200).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			if e, ok := decode(msg); ok && f.Match(e) {
+				out = append(out, e)
+				if len(out) == limit {
+					break
+				}
+			}
+		}
+		if len(msgs) < 200 {
+			break
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+	return out, nil
+}
+
+// CompareID 比较两个 Stream ID（形如 1700000000000-0），返回 -1/0/1
+func CompareID(a, b string) int {
+	am, as := splitID(a)
+	bm, bs := splitID(b)
+	switch {
+	case am < bm:
+		return -1
+	case am > bm:
+		return 1
+	case as < bs:
+		return -1
+	case as > bs:
+		return 1
+	}
+	return 0
+}
+
+func splitID(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	m, _ := strconv.ParseUint(ms, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+	return m, s
+}
+
+// ValidID 判断客户端传回的 Last-Event-ID 是否是合法的 Stream ID
+func ValidID(id string) bool {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return false
+	}
+	if _, err := strconv.ParseUint(ms, 10, 64); err != nil {
+		return false
+	}
+	_, err := strconv.ParseUint(seq, 10, 64)
+	return err == nil
+}
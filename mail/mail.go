@@ -2,35 +2,75 @@
 
 import (
 	"fmt"
-	"wzj_signin/config"
+	"io"
 
 	"github.com/spf13/viper"
 	"gopkg.in/gomail.v2"
 )
 
 func SendEmail(title string, message string, to string) {
-	_ = config.Load()
-	mailEnabled := viper.GetBool("mail.enabled")
-	if !mailEnabled {
-		return
+	if err := Send(title, message, to); err != nil {
+		fmt.Println("Error sending email to", to, err)
 	}
-	mailHost := viper.GetString("mail.host")
-	mailPort := viper.GetInt("mail.port")
-	mailUsername := viper.GetString("mail.username")
-	mailPassword := viper.GetString("mail.password")
-	mailFrom := viper.GetString("mail.from")
+}
 
-	m := gomail.NewMessage()
-	m.SetHeader("From", mailFrom)
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", title)
-	m.SetBody("text/plain", message)
+// Send 发送纯文本邮件（进入发送队列）；未启用邮件时直接返回 nil
+func Send(title string, message string, to string) error {
+	return SendMessage(Message{To: to, Subject: title, Text: message})
+}
 
-	d := gomail.NewDialer(mailHost, mailPort, mailUsername, mailPassword)
+// Inline 是以 CID 引用的内嵌图片，HTML 中用 cid:<Name> 引用
+type Inline struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
 
-	if err := d.DialAndSend(m); err != nil {
-		fmt.Println("Error sending email to", to, err)
-	} else {
-		fmt.Println(to, "Email sent successfully!")
+// Message 是一封邮件；HTML 非空时以 multipart/alternative 同时发送纯文本与 HTML
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Inline  []Inline
+	Urgent  bool `json:",omitempty"` // 紧急邮件（如二维码签到提醒）不受按收件人限流
+}
+
+// SendMessage 把邮件放入发送队列（见 queue.go），由后台 worker 异步发送；未启用邮件时直接返回 nil
+func SendMessage(msg Message) error {
+	if !viper.GetBool("mail.enabled") {
+		return nil
+	}
+	return Enqueue(msg)
+}
+
+// Deliver 立即建立连接发送一封邮件，不经过队列
+func Deliver(msg Message) error {
+	if err := deliverWith(Settings(), msg); err != nil {
+		return err
+	}
+	fmt.Println(msg.To, "Email sent successfully!")
+	return nil
+}
+
+func buildMessage(from string, msg Message) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Text)
+	if msg.HTML != "" {
+		m.AddAlternative("text/html", msg.HTML)
+		for _, img := range msg.Inline {
+			data := img.Data
+			m.Embed(img.Name,
+				gomail.SetHeader(map[string][]string{"Content-Type": {img.ContentType}}),
+				gomail.SetCopyFunc(func(w io.Writer) error {
+					_, err := w.Write(data)
+					return err
+				}),
+			)
+		}
 	}
+	return m
 }
@@ -0,0 +1,307 @@
+package mail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+
+	"wzj_signin/db"
+)
+
+// 发送队列：待发邮件在 Redis 列表 wzj:mail:queue，等待重试或限流的在有序集合 wzj:mail:retry（分数为到期时间），
+// 重试耗尽的进入 wzj:mail:failed（保留最近 failedMax 条），可在管理接口查看并重新入队。
+const (
+	queueKey  = "wzj:mail:queue"
+	retryKey  = "wzj:mail:retry"
+	failedKey = "wzj:mail:failed"
+	failedMax = 200
+
+	// worker 空闲这么久后断开 SMTP 连接，下一封邮件再重新建立
+	idleTimeout = 30 * time.Second
+)
+
+// Job 是队列中的一封邮件
+type Job struct {
+	ID        string     `json:"id"`
+	Message   Message    `json:"message"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"lastError,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	FailedAt  *time.Time `json:"failedAt,omitempty"`
+}
+
+// QueueStats 是队列概况
+type QueueStats struct {
+	Queued    int64 `json:"queued"`
+	Scheduled int64 `json:"scheduled"` // 等待重试或限流中
+	Failed    int64 `json:"failed"`
+}
+
+// ErrJobNotFound 表示失败列表中没有该邮件
+var ErrJobNotFound = errors.New("mail job not found")
+
+func newJobID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%d-%s", time.Now().UnixMilli(), hex.EncodeToString(b))
+}
+
+// Enqueue 把邮件放入发送队列
+func Enqueue(msg Message) error {
+	b, err := json.Marshal(Job{ID: newJobID(), Message: msg, CreatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return db.RedisRPush(queueKey, b).Err()
+}
+
+// StartQueue 启动发送队列的 worker（mail.queue.workers 个）与重试调度
+func StartQueue() {
+	workers := viper.GetInt("mail.queue.workers")
+	if workers <= 0 {
+		workers = 1
+	}
+	go scheduleLoop()
+	for i := 0; i < workers; i++ {
+		go (&worker{}).run()
+	}
+	log.Println("Mail queue started with", workers, "workers")
+}
+
+// scheduleLoop 把到期的重试与限流邮件移回发送队列
+func scheduleLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		due, err := db.RedisZRangeByScore(retryKey, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   fmt.Sprint(time.Now().UnixMilli()),
+			Count: 100,
+		}).Result()
+		if err != nil {
+			continue
+		}
+		for _, raw := range due {
+			// 多个实例同时调度时只有删除成功的一方负责入队
+			if n, _ := db.RedisZRem(retryKey, raw).Result(); n == 1 {
+				_ = db.RedisRPush(queueKey, raw).Err()
+			}
+		}
+	}
+}
+
+func schedule(job Job, at time.Time) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+	if err := db.RedisZAdd(retryKey, &redis.Z{Score: float64(at.UnixMilli()), Member: b}).Err(); err != nil {
+		log.Println("Error scheduling mail", job.ID, err)
+	}
+}
+
+// backoff 为第 n 次失败后的等待时间：mail.queue.retry_base_seconds 起按 2 的幂增长，最长 30 分钟
+func backoff(n int) time.Duration {
+	base := time.Duration(viper.GetInt("mail.queue.retry_base_seconds")) * time.Second
+	if base <= 0 {
+		base = 30 * time.Second
+	}
+	d := base << (n - 1)
+	if d > 30*time.Minute || d <= 0 {
+		d = 30 * time.Minute
+	}
+	return d
+}
+
+// allow 按收件人限流：每分钟最多 mail.queue.per_recipient_per_minute 封（0 表示不限制），紧急邮件不经过限流
+func allow(to string) bool {
+	limit := viper.GetInt64("mail.queue.per_recipient_per_minute")
+	if limit <= 0 {
+		return true
+	}
+	key := fmt.Sprintf("wzj:mail:rate:%s:%d", strings.ToLower(strings.TrimSpace(to)), time.Now().Unix()/60)
+	n, err := db.RedisIncr(key).Result()
+	if err != nil {
+		return true
+	}
+	if n == 1 {
+		_ = db.RedisExpire(key, 2*time.Minute).Err()
+	}
+	return n <= limit
+}
+
+type worker struct {
+	conn *smtpConn
+}
+
+func (w *worker) close() {
+	if w.conn != nil {
+		w.conn.close()
+		w.conn = nil
+	}
+}
+
+func (w *worker) run() {
+	for {
+		if !viper.GetBool("mail.enabled") {
+			// 邮件被关闭时不取出队列中的邮件，重新启用后继续发送
+			w.close()
+			time.Sleep(idleTimeout)
+			continue
+		}
+		vals, err := db.RedisBLPop(idleTimeout, queueKey).Result()
+		if err == redis.Nil {
+			w.close()
+			continue
+		}
+		if err != nil {
+			log.Println("Error reading mail queue:", err)
+			w.close()
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(vals[1]), &job); err != nil {
+			log.Println("Dropping malformed mail job:", err)
+			continue
+		}
+		if !viper.GetBool("mail.enabled") {
+			// 等待期间邮件被关闭：放回队首
+			if err := db.RedisLPush(queueKey, vals[1]).Err(); err != nil {
+				log.Println("Error requeueing mail", job.ID, "while mail is disabled:", err)
+			}
+			continue
+		}
+		if !job.Message.Urgent && !allow(job.Message.To) {
+			// 限流不算失败，推迟到下一分钟
+			schedule(job, time.Now().Truncate(time.Minute).Add(time.Minute))
+			continue
+		}
+		if err := w.send(job.Message); err != nil {
+			w.fail(job, err)
+			continue
+		}
+		log.Println(job.Message.To, "Email sent successfully!")
+	}
+}
+
+// send 复用已建立的 SMTP 连接；复用的连接可能已被服务器关闭，失败时重新连接再试一次
+func (w *worker) send(msg Message) error {
+	cfg := Settings()
+	reused := w.conn != nil
+	if w.conn == nil {
+		conn, err := dial(cfg)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	err := w.conn.send(cfg.From, msg)
+	if err == nil {
+		return nil
+	}
+	w.close()
+	if !reused {
+		return err
+	}
+	conn, dialErr := dial(cfg)
+	if dialErr != nil {
+		return dialErr
+	}
+	w.conn = conn
+	if err := w.conn.send(cfg.From, msg); err != nil {
+		w.close()
+		return err
+	}
+	return nil
+}
+
+func (w *worker) fail(job Job, cause error) {
+	job.Attempts++
+	job.LastError = cause.Error()
+	maxAttempts := viper.GetInt("mail.queue.max_attempts")
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	if job.Attempts < maxAttempts {
+		wait := backoff(job.Attempts)
+		log.Printf("Error sending email to %s (attempt %d/%d), retrying in %s: %v", job.Message.To, job.Attempts, maxAttempts, wait, cause)
+		schedule(job, time.Now().Add(wait))
+		return
+	}
+	log.Printf("Error sending email to %s, giving up after %d attempts: %v", job.Message.To, job.Attempts, cause)
+	now := time.Now()
+	job.FailedAt = &now
+	b, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+	_ = db.RedisLPush(failedKey, b).Err()
+	_ = db.RedisLTrim(failedKey, 0, failedMax-1).Err()
+}
+
+// Stats 返回队列长度、等待重试数与失败数
+func Stats() (QueueStats, error) {
+	var s QueueStats
+	var err error
+	if s.Queued, err = db.RedisLLen(queueKey).Result(); err != nil {
+		return s, err
+	}
+	if s.Scheduled, err = db.RedisZCard(retryKey).Result(); err != nil {
+		return s, err
+	}
+	s.Failed, err = db.RedisLLen(failedKey).Result()
+	return s, err
+}
+
+// FailedJobs 返回最近发送失败的邮件，新的在前；内嵌图片不返回
+func FailedJobs(limit int) ([]Job, error) {
+	if limit <= 0 || limit > failedMax {
+		limit = failedMax
+	}
+	vals, err := db.RedisLRange(failedKey, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Job, 0, len(vals))
+	for _, v := range vals {
+		var job Job
+		if json.Unmarshal([]byte(v), &job) == nil {
+			job.Message.Inline = nil
+			out = append(out, job)
+		}
+	}
+	return out, nil
+}
+
+// RetryFailed 把失败列表中的邮件重新放入发送队列，重试次数清零
+func RetryFailed(id string) error {
+	vals, err := db.RedisLRange(failedKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, raw := range vals {
+		var job Job
+		if json.Unmarshal([]byte(raw), &job) != nil || job.ID != id {
+			continue
+		}
+		if n, _ := db.RedisLRem(failedKey, 1, raw).Result(); n == 0 {
+			return ErrJobNotFound
+		}
+		job.Attempts, job.LastError, job.FailedAt = 0, "", nil
+		b, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		return db.RedisRPush(queueKey, b).Err()
+	}
+	return ErrJobNotFound
+}
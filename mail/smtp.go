@@ -0,0 +1,250 @@
+package mail
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/config"
+)
+
+// 连接与单封邮件的读写超时
+const (
+	dialTimeout = 10 * time.Second
+	ioTimeout   = time.Minute
+)
+
+// SMTPError 标明 SMTP 会话在哪一步失败（dial / tls / greeting / helo / starttls / auth / mail from / rcpt to / data）
+type SMTPError struct {
+	Stage string
+	Err   error
+}
+
+func (e *SMTPError) Error() string { return e.Stage + ": " + e.Err.Error() }
+
+func (e *SMTPError) Unwrap() error { return e.Err }
+
+// Code 返回服务器的 SMTP 响应码，非协议错误（网络、证书等）时为 0
+func (e *SMTPError) Code() int {
+	var te *textproto.Error
+	if errors.As(e.Err, &te) {
+		return te.Code
+	}
+	return 0
+}
+
+// Settings 读取当前生效的 mail.* 配置（含密码）
+func Settings() config.MailConfig {
+	return config.MailConfig{
+		Enabled:            viper.GetBool("mail.enabled"),
+		Host:               viper.GetString("mail.host"),
+		Port:               viper.GetInt("mail.port"),
+		Username:           viper.GetString("mail.username"),
+		Password:           viper.GetString("mail.password"),
+		From:               viper.GetString("mail.from"),
+		Security:           viper.GetString("mail.security"),
+		InsecureSkipVerify: viper.GetBool("mail.insecure_skip_verify"),
+		Helo:               viper.GetString("mail.helo"),
+		Auth:               viper.GetString("mail.auth"),
+	}
+}
+
+// smtpConn 是一条已认证的 SMTP 连接，可连续发送多封邮件
+type smtpConn struct {
+	conn   net.Conn
+	client *smtp.Client
+}
+
+// dial 按配置建立连接：security 为 ssl 时直接 TLS，starttls 要求服务器支持 STARTTLS，
+// none 不加密；留空时 465 端口用 ssl，其它端口在服务器支持时升级 STARTTLS。
+func dial(cfg config.MailConfig) (*smtpConn, error) {
+	host := strings.TrimSpace(cfg.Host)
+	if host == "" {
+		return nil, &SMTPError{"config", errors.New("SMTP host is not configured")}
+	}
+	security := strings.ToLower(strings.TrimSpace(cfg.Security))
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+		if security == "ssl" {
+			port = 465
+		}
+	}
+	if security == "" && port == 465 {
+		security = "ssl"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if security == "ssl" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, &SMTPError{"tls", err}
+		}
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+		if err != nil {
+			return nil, &SMTPError{"dial", err}
+		}
+	}
+	_ = conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, &SMTPError{"greeting", err}
+	}
+	fail := func(stage string, err error) (*smtpConn, error) {
+		c.Close()
+		return nil, &SMTPError{stage, err}
+	}
+
+	helo := strings.TrimSpace(cfg.Helo)
+	if helo == "" {
+		helo = "localhost"
+	}
+	if err := c.Hello(helo); err != nil {
+		return fail("helo", err)
+	}
+	if security != "ssl" && security != "none" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return fail("starttls", err)
+			}
+		} else if security == "starttls" {
+			return fail("starttls", errors.New("server does not support STARTTLS"))
+		}
+	}
+
+	if cfg.Username != "" && strings.ToLower(cfg.Auth) != "none" {
+		auth, err := authFor(c, cfg, host)
+		if err != nil {
+			return fail("auth", err)
+		}
+		if err := c.Auth(auth); err != nil {
+			return fail("auth", err)
+		}
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return &smtpConn{conn: conn, client: c}, nil
+}
+
+// authFor 选择认证方式；留空时优先 CRAM-MD5，服务器只支持 LOGIN 时用 LOGIN，否则 PLAIN
+func authFor(c *smtp.Client, cfg config.MailConfig, host string) (smtp.Auth, error) {
+	mech := strings.ToLower(strings.TrimSpace(cfg.Auth))
+	if mech == "" {
+		_, params := c.Extension("AUTH")
+		params = strings.ToUpper(params)
+		switch {
+		case strings.Contains(params, "CRAM-MD5"):
+			mech = "cram-md5"
+		case strings.Contains(params, "LOGIN") && !strings.Contains(params, "PLAIN"):
+			mech = "login"
+		default:
+			mech = "plain"
+		}
+	}
+	switch mech {
+	case "plain":
+		return smtp.PlainAuth("", cfg.Username, cfg.Password, host), nil
+	case "login":
+		return &loginAuth{username: cfg.Username, password: cfg.Password, host: host}, nil
+	case "cram-md5":
+		return smtp.CRAMMD5Auth(cfg.Username, cfg.Password), nil
+	}
+	return nil, fmt.Errorf("unsupported auth mechanism %q", cfg.Auth)
+}
+
+// loginAuth 实现 AUTH LOGIN（net/smtp 未提供），与 PlainAuth 一样只在加密连接或本机上发送密码
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && a.host != "localhost" && a.host != "127.0.0.1" && a.host != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(string(fromServer))
+	switch {
+	case strings.Contains(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.Contains(prompt, "password"):
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+}
+
+// send 在已建立的连接上发送一封邮件
+func (s *smtpConn) send(from string, msg Message) error {
+	_ = s.conn.SetDeadline(time.Now().Add(ioTimeout))
+	defer s.conn.SetDeadline(time.Time{})
+
+	sender := from
+	if addr, err := netmail.ParseAddress(from); err == nil {
+		sender = addr.Address
+	}
+	if err := s.client.Mail(sender); err != nil {
+		return &SMTPError{"mail from", err}
+	}
+	if err := s.client.Rcpt(msg.To); err != nil {
+		return &SMTPError{"rcpt to", err}
+	}
+	w, err := s.client.Data()
+	if err != nil {
+		return &SMTPError{"data", err}
+	}
+	if _, err := buildMessage(from, msg).WriteTo(w); err != nil {
+		w.Close()
+		return &SMTPError{"data", err}
+	}
+	if err := w.Close(); err != nil {
+		return &SMTPError{"data", err}
+	}
+	return nil
+}
+
+func (s *smtpConn) close() {
+	if err := s.client.Quit(); err != nil {
+		s.client.Close()
+	}
+}
+
+// deliverWith 用给定配置建立连接发送一封邮件后断开
+func deliverWith(cfg config.MailConfig, msg Message) error {
+	conn, err := dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+	return conn.send(cfg.From, msg)
+}
+
+// Test 用给定配置立即发送一封测试邮件，返回带失败步骤的详细错误（*SMTPError）
+func Test(cfg config.MailConfig, to string) error {
+	return deliverWith(cfg, Message{
+		To:      to,
+		Subject: "wzj_signin 测试邮件",
+		Text:    "这是一封测试邮件，收到说明 SMTP 配置可用。\n发送时间：" + time.Now().Format("2006-01-02 15:04:05"),
+	})
+}
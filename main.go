@@ -1,9 +1,12 @@
 ﻿package main
 
 import (
+	"os"
 	"time"
 	"wzj_signin/config"
 	"wzj_signin/db"
+	"wzj_signin/mail"
+	"wzj_signin/notify"
 	"wzj_signin/server"
 	"wzj_signin/service"
 
@@ -14,8 +17,15 @@ func main() {
 	if err := config.Load(); err != nil {
 		panic(err)
 	}
+	if runCommand(os.Args[1:]) {
+		return
+	}
 	db.InitRedis()
+	mail.StartQueue()
 	go startTimer()
+	go service.StartTelegramBot()
+	go service.StartDigest()
+	go notify.StartQuietHours()
 	server.Start()
 }
 
@@ -27,6 +37,9 @@ func startTimer() {
 	for range ticker.C {
 		for _, openId := range db.RedisGetAllMatchedKeys("wzj:user:*") {
 			openId := openId[9:]
+			if service.IsPaused(openId) {
+				continue
+			}
 			signList, _ := service.GetAllSigns(openId)
 			for _, sign := range signList {
 				go service.Signin(sign, openId)
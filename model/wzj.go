@@ -1,5 +1,7 @@
 ﻿package model
 
+import "time"
+
 type SignResultData struct {
 	SignRank    int `json:"signRank"`
 	StudentRank int `json:"studentRank"`
@@ -15,4 +17,8 @@ type SignData struct {
 	StartYear int    `json:"startYear"`
 	Term      string `json:"term"`
 	Cover     string `json:"cover"`
+
+	// 以下字段不来自接口，由 GetAllSigns 填写，用于签到历史的时间统计
+	DetectedAt time.Time `json:"-"`
+	PollMs     int64     `json:"-"`
 }
\ No newline at end of file
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 日报 / 周报的周期
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// 汇总中单个签到的最终状态
+const (
+	DigestSigned   = "signed"    // 自动签到成功
+	DigestFailed   = "failed"    // 自动签到失败且之后没有成功
+	DigestQRDone   = "qr_done"   // 二维码签到已完成
+	DigestQRMissed = "qr_missed" // 二维码签到没有完成
+	DigestPending  = "pending"   // 发现后还没有提交（如仍在延迟中）
+)
+
+// Digest 是一个账号在 [From, To) 内的签到汇总，由服务端签到历史生成
+type Digest struct {
+	Period     string       `json:"period"` // daily / weekly
+	From       time.Time    `json:"from"`
+	To         time.Time    `json:"to"`
+	Detected   int          `json:"detected"`
+	AutoSigned int          `json:"autoSigned"`
+	Failed     int          `json:"failed"`
+	QRDetected int          `json:"qrDetected"`
+	QRMissed   int          `json:"qrMissed"`
+	Expired    []string     `json:"expired,omitempty"` // 期间失效的 OpenID
+	Signs      []DigestSign `json:"signs,omitempty"`   // 按发现时间排序
+}
+
+// DigestSign 是汇总中的一个签到
+type DigestSign struct {
+	Time        time.Time `json:"time"`
+	CourseName  string    `json:"courseName"`
+	Mode        string    `json:"mode"`
+	Status      string    `json:"status"`
+	Reason      string    `json:"reason,omitempty"`
+	StudentRank int       `json:"studentRank,omitempty"`
+}
+
+// Empty 表示期间既没有签到也没有 OpenID 失效
+func (d *Digest) Empty() bool {
+	return len(d.Signs) == 0 && len(d.Expired) == 0
+}
+
+// Span 返回汇总覆盖的日期，如 “10月19日” 或 “10月13日 - 10月19日”
+func (d *Digest) Span() string {
+	last := d.To.Add(-time.Second)
+	if d.Period == DigestWeekly {
+		return d.From.Format("1月2日") + " - " + last.Format("1月2日")
+	}
+	return last.Format("1月2日")
+}
+
+// digestLines 返回逐条签到明细，卡片类渠道在关键字段之后列出
+func digestLines(d *Digest) []string {
+	if d == nil {
+		return nil
+	}
+	out := make([]string, 0, len(d.Signs))
+	for _, s := range d.Signs {
+		out = append(out, messageBlock("digestLine", s))
+	}
+	return out
+}
+
+func digestFacts(d *Digest) []Fact {
+	if d == nil {
+		return nil
+	}
+	out := []Fact{
+		{"发现签到", fmt.Sprintf("%d 次", d.Detected)},
+		{"自动签到成功", fmt.Sprintf("%d 次", d.AutoSigned)},
+		{"自动签到失败", fmt.Sprintf("%d 次", d.Failed)},
+		{"二维码签到未完成", fmt.Sprintf("%d / %d 次", d.QRMissed, d.QRDetected)},
+	}
+	if len(d.Expired) > 0 {
+		out = append(out, Fact{"失效的 OpenID", strings.Join(d.Expired, "、")})
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/config"
+	"wzj_signin/mail"
+	"wzj_signin/qr"
+)
+
+func init() {
+	Register("email", newEmail)
+}
+
+// emailNotifier 通过全局 SMTP 配置（mail.*）发送纯文本 + HTML 邮件，target 为收件地址，
+// options.locale 选择模板语言（默认 mail.locale）
+type emailNotifier struct {
+	to     string
+	locale string
+}
+
+func newEmail(ch config.NotifyChannel) (Notifier, error) {
+	to := strings.TrimSpace(ch.Target)
+	if !strings.Contains(to, "@") {
+		return nil, errors.New("email channel requires a target address")
+	}
+	return &emailNotifier{to: to, locale: emailLocale(ch)}, nil
+}
+
+func (n *emailNotifier) Name() string { return "email:" + n.to }
+
+func (n *emailNotifier) Notify(ctx context.Context, e Event) error {
+	if !viper.GetBool("mail.enabled") {
+		return nil
+	}
+	// 二维码签到几分钟内就会关闭，不能被限流推迟到下一分钟
+	msg := mail.Message{To: n.to, Urgent: e.Type == EventQRRequired}
+
+	// 二维码提醒内嵌发信时的二维码，方便在电脑上看邮件时直接用手机扫
+	qrImage := ""
+	if e.Type == EventQRRequired && e.SignId > 0 {
+		if qrUrl := waitQrUrl(ctx, e.SignId, 10*time.Second); qrUrl != "" {
+			if png, err := qr.RenderPNG(qrUrl, qr.DefaultImageOptions()); err == nil {
+				qrImage = "qr.png"
+				msg.Inline = append(msg.Inline, mail.Inline{Name: qrImage, ContentType: "image/png", Data: png})
+			}
+		}
+	}
+
+	subject, text, html, err := renderEmail(e, n.locale, qrImage)
+	if err != nil {
+		// 覆盖的模板有误时退回内置文案，不影响提醒送达
+		log.Println("Error rendering email template, falling back to plain text:", err)
+		subject, text, html = e.Title(), e.Text(), ""
+		msg.Inline = nil
+	}
+	msg.Subject, msg.Text, msg.HTML = subject, text, html
+	return mail.SendMessage(msg)
+}
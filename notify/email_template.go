@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/config"
+)
+
+// 内置邮件模板：templates/<语言>/email.txt 定义 "subject" 与 "text" 块，email.html 为 HTML 正文。
+// data/templates/<语言>/ 下的同名文件会覆盖内置模板；<事件>.txt / <事件>.html（如 qr_required.html）
+// 在基础模板之后解析，只需重定义要修改的块。
+//
+//go:embed templates
+var builtinTemplates embed.FS
+
+const defaultLocale = "zh-CN"
+
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// emailData 是模板的数据：事件的全部字段与 Title / Text / Facts 方法，外加渲染用的字段
+type emailData struct {
+	Event
+	Lines   []string // Text 按行拆分，HTML 中逐段展示
+	QrImage string   // 内嵌二维码的 CID，没有图片时为空
+}
+
+var emailFuncs = map[string]interface{}{
+	"inc":  func(n int) int { return n + 1 },
+	"mode": modeName,
+	"trim": strings.TrimSpace,
+}
+
+// emailLocale 依次取渠道的 options.locale、mail.locale，缺省为 zh-CN
+func emailLocale(ch config.NotifyChannel) string {
+	for _, l := range []string{ch.Options["locale"], viper.GetString("mail.locale")} {
+		if l = strings.TrimSpace(l); localePattern.MatchString(l) {
+			return l
+		}
+	}
+	return defaultLocale
+}
+
+// readTemplate 优先读取 data/templates 下的覆盖文件；builtin 为 false 时只查找覆盖文件
+func readTemplate(locale string, name string, builtin bool) (string, bool, error) {
+	b, err := os.ReadFile(filepath.Join(config.TemplatesDir(), locale, name))
+	if err == nil {
+		return string(b), true, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", false, err
+	}
+	if !builtin {
+		return "", false, nil
+	}
+	for _, l := range []string{locale, defaultLocale} {
+		if b, err := builtinTemplates.ReadFile(path.Join("templates", l, name)); err == nil {
+			return string(b), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// renderEmail 按语言渲染邮件标题、纯文本与 HTML 正文
+func renderEmail(e Event, locale string, qrImage string) (subject string, text string, html string, err error) {
+	if _, err := builtinTemplates.ReadDir(path.Join("templates", locale)); err != nil {
+		// 没有内置模板的语言只有在提供了覆盖文件时才使用
+		if _, statErr := os.Stat(filepath.Join(config.TemplatesDir(), locale)); statErr != nil {
+			locale = defaultLocale
+		}
+	}
+
+	var sources []string // 依次解析：email.txt、<事件>.txt
+	for _, name := range []string{"email.txt", e.Type + ".txt"} {
+		src, ok, err := readTemplate(locale, name, name == "email.txt")
+		if err != nil {
+			return "", "", "", err
+		}
+		if ok {
+			sources = append(sources, src)
+		}
+	}
+
+	txt := texttemplate.New("email.txt").Funcs(emailFuncs)
+	for _, src := range sources {
+		if _, err := txt.Parse(src); err != nil {
+			return "", "", "", err
+		}
+	}
+	data := emailData{Event: e, QrImage: qrImage}
+	for _, line := range strings.Split(e.Text(), "\n") {
+		if strings.TrimSpace(line) != "" {
+			data.Lines = append(data.Lines, line)
+		}
+	}
+	var buf bytes.Buffer
+	if err := txt.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", "", err
+	}
+	// 标题不能换行
+	subject = strings.Join(strings.Fields(buf.String()), " ")
+	buf.Reset()
+	if err := txt.ExecuteTemplate(&buf, "text", data); err != nil {
+		return "", "", "", err
+	}
+	text = strings.TrimSpace(buf.String())
+
+	// HTML 模板可以引用 email.txt 中定义的块
+	htmlSrc, ok, err := readTemplate(locale, "email.html", true)
+	if err != nil || !ok {
+		return subject, text, "", err
+	}
+	h := htmltemplate.New("email").Funcs(emailFuncs)
+	for i, src := range sources {
+		if _, err := h.New(fmt.Sprintf("text-%d", i)).Parse(src); err != nil {
+			return "", "", "", err
+		}
+	}
+	if _, err := h.New("email.html").Parse(htmlSrc); err != nil {
+		return "", "", "", err
+	}
+	src, ok, err := readTemplate(locale, e.Type+".html", false)
+	if err != nil {
+		return "", "", "", err
+	}
+	if ok {
+		if _, err := h.New(e.Type + ".html").Parse(src); err != nil {
+			return "", "", "", err
+		}
+	}
+	buf.Reset()
+	if err := h.ExecuteTemplate(&buf, "email.html", data); err != nil {
+		return "", "", "", err
+	}
+	return subject, text, buf.String(), nil
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// messageTemplate 是内置的 zh-CN 邮件模板，各渠道共用的标题与正文由其中的 "subject" / "text" 块生成
+var messageTemplate = texttemplate.Must(texttemplate.New("email.txt").Funcs(emailFuncs).
+	ParseFS(builtinTemplates, path.Join("templates", defaultLocale, "email.txt")))
+
+// messageBlock 用内置模板渲染一个块，data 为 Event 或其中的字段
+func messageBlock(name string, data interface{}) string {
+	var buf bytes.Buffer
+	if err := messageTemplate.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Println("Error rendering message template:", err)
+	}
+	return buf.String()
+}
+
+// Title 返回通知标题，各渠道共用
+func (e Event) Title() string {
+	return strings.Join(strings.Fields(messageBlock("subject", e)), " ")
+}
+
+// Text 返回纯文本正文，各渠道共用
+func (e Event) Text() string {
+	return strings.TrimSpace(messageBlock("text", e))
+}
+
+func modeName(mode string) string {
+	switch mode {
+	case "gps":
+		return "GPS "
+	case "qr":
+		return "二维码"
+	}
+	return "普通"
+}
+
+// Fact 是卡片类消息中的一行“标签：内容”
+type Fact struct {
+	Label string
+	Value string
+}
+
+// Facts 返回卡片展示用的关键字段（课程、签到类型、排名、失败原因等），空值会被省略
+func (e Event) Facts() []Fact {
+	switch e.Type {
+	case EventDigest:
+		return digestFacts(e.Digest)
+	case EventBatch:
+		return batchFacts(e)
+	}
+	var out []Fact
+	add := func(label, value string) {
+		if strings.TrimSpace(value) != "" {
+			out = append(out, Fact{label, value})
+		}
+	}
+	add("课程", e.CourseName)
+	if e.Mode != "" {
+		add("签到类型", strings.TrimSpace(modeName(e.Mode))+"签到")
+	}
+	if e.StudentRank > 0 {
+		add("排名", fmt.Sprintf("第 %d 个签到（签到 No.%d）", e.StudentRank, e.SignRank))
+	}
+	if e.Type == EventFailed {
+		add("原因", e.Reason)
+	}
+	if e.OnBehalfOf != "" {
+		add("需要帮忙的同学", e.OnBehalfOf)
+	}
+	if len(e.Accounts) > 1 {
+		add("需要扫码的账号", strings.Join(e.Accounts, "、"))
+	}
+	if e.OpenId != "" {
+		add("OpenID", e.OpenId)
+	}
+	return out
+}
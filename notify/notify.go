@@ -0,0 +1,212 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wzj_signin/config"
+)
+
+// 通知事件类型
+const (
+	EventDetected   = "sign_detected"  // 轮询发现了一个签到
+	EventSigned     = "signed"         // 自动签到成功
+	EventFailed     = "sign_failed"    // 自动签到失败
+	EventQRRequired = "qr_required"    // 二维码签到需要手动扫码（含升级提醒）
+	EventExpired    = "openid_expired" // OpenID 失效
+	EventDigest     = "digest"         // 签到日报 / 周报
+
+	// EventBatch 是免打扰结束后合并发送的积压通知，不能单独订阅
+	EventBatch = "batch"
+)
+
+// AllEvents 按展示顺序列出全部事件类型
+var AllEvents = []string{EventDetected, EventSigned, EventFailed, EventQRRequired, EventExpired, EventDigest}
+
+// DefaultEvents 是渠道未指定 events 时订阅的事件，与以前只发邮件的行为一致；
+// 日报 / 周报是否发送另由 digest.* 与账号设置决定
+var DefaultEvents = []string{EventSigned, EventQRRequired, EventDigest}
+
+// Event 是一次要发出的通知。Email 决定按哪个账号的渠道设置分发。
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Email      string    `json:"email"`
+	OpenId     string    `json:"openId,omitempty"`
+	CourseId   int       `json:"courseId,omitempty"`
+	SignId     int       `json:"signId,omitempty"`
+	CourseName string    `json:"courseName,omitempty"`
+	Mode       string    `json:"mode,omitempty"`
+
+	SignRank    int    `json:"signRank,omitempty"`
+	StudentRank int    `json:"studentRank,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Cover       string `json:"cover,omitempty"` // 课程封面图片地址
+
+	// 二维码签到
+	QrPage     string   `json:"qrPage,omitempty"`
+	Accounts   []string `json:"accounts,omitempty"`   // 共用二维码的账号（已脱敏）
+	Reminder   int      `json:"reminder,omitempty"`   // 第几次升级重发，0 为首次提醒
+	OnBehalfOf string   `json:"onBehalfOf,omitempty"` // 请同学帮忙时，需要扫码的账号邮箱
+	Secondary  bool     `json:"secondary,omitempty"`  // 发给备用联系方式
+
+	Digest *Digest `json:"digest,omitempty"` // 仅 digest 事件
+	Batch  []Event `json:"batch,omitempty"`  // 仅 batch 事件，按发生时间排序
+}
+
+// Notifier 是一个通知渠道实例（某个账号配置的邮箱、webhook 等）
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, e Event) error
+}
+
+// Factory 根据账号的渠道配置创建 Notifier，配置不完整时返回错误
+type Factory func(ch config.NotifyChannel) (Notifier, error)
+
+var (
+	registryMu sync.RWMutex
+	factories  = map[string]Factory{}
+)
+
+// Register 登记一种渠道类型，由各渠道文件的 init 调用
+func Register(kind string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	factories[kind] = f
+}
+
+// Kinds 返回已登记的渠道类型
+func Kinds() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]string, 0, len(factories))
+	for k := range factories {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// New 根据渠道配置创建 Notifier
+func New(ch config.NotifyChannel) (Notifier, error) {
+	registryMu.RLock()
+	f, ok := factories[ch.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown channel type %q", ch.Type)
+	}
+	return f(ch)
+}
+
+// Validate 检查渠道配置，供设置接口在保存前调用
+func Validate(ch config.NotifyChannel) error {
+	for _, ev := range ch.Events {
+		if !knownEvent(ev) {
+			return fmt.Errorf("unknown event %q", ev)
+		}
+	}
+	_, err := New(ch)
+	return err
+}
+
+func knownEvent(ev string) bool {
+	for _, e := range AllEvents {
+		if e == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveEvents 返回渠道实际订阅的事件，未指定时为 DefaultEvents
+func EffectiveEvents(ch config.NotifyChannel) []string {
+	if len(ch.Events) == 0 {
+		return DefaultEvents
+	}
+	return ch.Events
+}
+
+// Wants 判断渠道是否订阅了该事件
+func Wants(ch config.NotifyChannel, event string) bool {
+	for _, e := range EffectiveEvents(ch) {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Channels 返回账号启用的渠道；账号未配置任何渠道时默认用账号邮箱发邮件
+func Channels(email string) []config.NotifyChannel {
+	email = config.NormalizeEmail(email)
+	if email == "" {
+		return nil
+	}
+	settings, err := config.GetAccountSettings(email)
+	if err != nil {
+		log.Println("Error reading account settings:", err)
+	}
+	if len(settings.Channels) == 0 {
+		return []config.NotifyChannel{{ID: "email", Type: "email", Enabled: true, Target: email}}
+	}
+	var out []config.NotifyChannel
+	for _, ch := range settings.Channels {
+		if !ch.Enabled {
+			continue
+		}
+		if ch.Type == "email" && strings.TrimSpace(ch.Target) == "" {
+			ch.Target = email
+		}
+		out = append(out, ch)
+	}
+	return out
+}
+
+// Dispatch 把事件分发到 e.Email 对应账号启用且订阅了该事件的全部渠道，各渠道并发发送。
+// 账号处于免打扰时段时，除 qr_required 外的事件先积压，时段结束后合并发送。
+func Dispatch(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	var targets []config.NotifyChannel
+	for _, ch := range Channels(e.Email) {
+		if Wants(ch, e.Type) {
+			targets = append(targets, ch)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	if e.Type != EventQRRequired && holdIfQuiet(e) {
+		return
+	}
+	for _, ch := range targets {
+		go Send(ch, e)
+	}
+}
+
+// Send 通过单个渠道发送，错误只记录日志
+func Send(ch config.NotifyChannel, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	n, err := New(ch)
+	if err != nil {
+		log.Println("Notify channel misconfigured:", ch.ID, err)
+		return err
+	}
+	// 给带重试的渠道留足时间，单次请求的超时由各渠道自己控制
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := n.Notify(ctx, e); err != nil {
+		log.Println("Notify failed:", n.Name(), e.Type, e.Email, err)
+		return err
+	}
+	return nil
+}
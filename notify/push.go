@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"wzj_signin/config"
+)
+
+// 自建推送：ntfy、Gotify、Bark、Server酱。服务器地址都可配置，便于指向本地实例。
+func init() {
+	Register("ntfy", newNtfy)
+	Register("gotify", newGotify)
+	Register("bark", newBark)
+	Register("serverchan", newServerChan)
+}
+
+// 事件紧急程度，各推送服务按自己的取值映射
+const (
+	priorityLow = iota
+	priorityDefault
+	priorityHigh
+	priorityUrgent
+)
+
+// 二维码会在几秒内轮换，需要扫码的提醒一律按最高优先级发送
+func priorityOf(e Event) int {
+	switch e.Type {
+	case EventQRRequired:
+		return priorityUrgent
+	case EventFailed, EventExpired:
+		return priorityHigh
+	case EventDetected, EventDigest:
+		return priorityLow
+	}
+	return priorityDefault
+}
+
+func parseServer(raw string, fallback string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		raw = fallback
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("invalid server URL")
+	}
+	return strings.TrimRight(raw, "/"), nil
+}
+
+// ===== ntfy：target 为主题地址（如 https://ntfy.sh/my-topic），secret 为访问令牌 =====
+
+type ntfyNotifier struct {
+	server string
+	topic  string
+	token  string
+}
+
+func newNtfy(ch config.NotifyChannel) (Notifier, error) {
+	u, err := url.Parse(strings.TrimSpace(ch.Target))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("ntfy channel requires the topic URL as target")
+	}
+	topic := strings.Trim(u.Path, "/")
+	if topic == "" || strings.Contains(topic, "/") {
+		return nil, errors.New("ntfy target must look like https://ntfy.sh/<topic>")
+	}
+	return &ntfyNotifier{server: u.Scheme + "://" + u.Host, topic: topic, token: strings.TrimSpace(ch.Secret)}, nil
+}
+
+func (n *ntfyNotifier) Name() string { return "ntfy:" + n.topic }
+
+func (n *ntfyNotifier) Notify(ctx context.Context, e Event) error {
+	payload := map[string]interface{}{
+		"topic":    n.topic,
+		"title":    e.Title(),
+		"message":  e.Text(),
+		"priority": [...]int{2, 3, 4, 5}[priorityOf(e)],
+	}
+	if e.QrPage != "" {
+		payload["click"] = e.QrPage
+		payload["tags"] = []string{"rotating_light"}
+	}
+	header := http.Header{}
+	if n.token != "" {
+		header.Set("Authorization", "Bearer "+n.token)
+	}
+	_, err := postJSON(ctx, n.server, header, payload)
+	return err
+}
+
+// ===== Gotify：target 为服务器地址，secret 为应用令牌 =====
+
+type gotifyNotifier struct {
+	server string
+	token  string
+}
+
+func newGotify(ch config.NotifyChannel) (Notifier, error) {
+	server, err := parseServer(ch.Target, "")
+	if err != nil {
+		return nil, errors.New("gotify channel requires the server URL as target")
+	}
+	if strings.TrimSpace(ch.Secret) == "" {
+		return nil, errors.New("gotify channel requires the application token as secret")
+	}
+	return &gotifyNotifier{server: server, token: strings.TrimSpace(ch.Secret)}, nil
+}
+
+func (n *gotifyNotifier) Name() string { return "gotify" }
+
+func (n *gotifyNotifier) Notify(ctx context.Context, e Event) error {
+	payload := map[string]interface{}{
+		"title":    e.Title(),
+		"message":  e.Text(),
+		"priority": [...]int{2, 5, 8, 10}[priorityOf(e)],
+	}
+	if e.QrPage != "" {
+		payload["extras"] = map[string]interface{}{
+			"client::notification": map[string]interface{}{"click": map[string]string{"url": e.QrPage}},
+		}
+	}
+	header := http.Header{}
+	header.Set("X-Gotify-Key", n.token)
+	_, err := postJSON(ctx, n.server+"/message", header, payload)
+	return err
+}
+
+// ===== Bark：target 为服务器地址（留空为 https://api.day.app），secret 为设备 key =====
+
+type barkNotifier struct {
+	server string
+	key    string
+}
+
+func newBark(ch config.NotifyChannel) (Notifier, error) {
+	server, err := parseServer(ch.Target, "https://api.day.app")
+	if err != nil {
+		return nil, errors.New("bark target must be the server URL")
+	}
+	if strings.TrimSpace(ch.Secret) == "" {
+		return nil, errors.New("bark channel requires the device key as secret")
+	}
+	return &barkNotifier{server: server, key: strings.TrimSpace(ch.Secret)}, nil
+}
+
+func (n *barkNotifier) Name() string { return "bark" }
+
+func (n *barkNotifier) Notify(ctx context.Context, e Event) error {
+	payload := map[string]interface{}{
+		"device_key": n.key,
+		"title":      e.Title(),
+		"body":       e.Text(),
+		"group":      "wzj_signin",
+		"level":      [...]string{"passive", "active", "active", "timeSensitive"}[priorityOf(e)],
+	}
+	if e.QrPage != "" {
+		payload["url"] = e.QrPage
+		payload["sound"] = "alarm"
+	}
+	body, err := postJSON(ctx, n.server+"/push", nil, payload)
+	if err != nil {
+		return err
+	}
+	return codeError(body)
+}
+
+// ===== Server酱：target 为服务器地址（留空为 https://sctapi.ftqq.com），secret 为 SendKey =====
+
+type serverChanNotifier struct {
+	server string
+	key    string
+}
+
+func newServerChan(ch config.NotifyChannel) (Notifier, error) {
+	server, err := parseServer(ch.Target, "https://sctapi.ftqq.com")
+	if err != nil {
+		return nil, errors.New("serverchan target must be the server URL")
+	}
+	if strings.TrimSpace(ch.Secret) == "" {
+		return nil, errors.New("serverchan channel requires the SendKey as secret")
+	}
+	return &serverChanNotifier{server: server, key: strings.TrimSpace(ch.Secret)}, nil
+}
+
+func (n *serverChanNotifier) Name() string { return "serverchan" }
+
+func (n *serverChanNotifier) Notify(ctx context.Context, e Event) error {
+	// Server酱没有优先级，紧急事件在标题前加标记
+	title := e.Title()
+	if priorityOf(e) == priorityUrgent {
+		title = "【紧急】" + title
+	}
+	desp := e.Text()
+	if e.QrPage != "" {
+		desp += "\n\n[打开二维码页](" + e.QrPage + ")"
+	}
+	body, err := postJSON(ctx, fmt.Sprintf("%s/%s.send", n.server, url.PathEscape(n.key)), nil, map[string]string{
+		"title": title,
+		"desp":  desp,
+	})
+	if err != nil {
+		return err
+	}
+	return codeError(body)
+}
+
+// Bark 与 Server酱在响应体的 code 字段返回结果：Bark 成功为 200，Server酱成功为 0
+func codeError(body []byte) error {
+	var r struct {
+		Code    *int   `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil || r.Code == nil {
+		return nil
+	}
+	if *r.Code != 0 && *r.Code != 200 {
+		return fmt.Errorf("code %d: %s", *r.Code, r.Message)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/config"
+	"wzj_signin/db"
+)
+
+// 免打扰：账号设置了 quietHours 时，时段内除 qr_required 以外的通知先存入 wzj:notify:held:<邮箱>，
+// 时段结束（或关闭免打扰）后按渠道合并为一条 batch 通知发出，只积压了一条时原样发送。
+const (
+	heldPrefix     = "wzj:notify:held:"
+	flushingPrefix = "wzj:notify:flushing:"
+	heldMax        = 200
+	heldTTL        = 48 * time.Hour
+)
+
+// clockMinutes 把 HH:MM 转为当天的分钟数
+func clockMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func quietLocation(q config.QuietHours) (*time.Location, error) {
+	name := q.Timezone
+	if name == "" {
+		name = strings.TrimSpace(viper.GetString("digest.timezone"))
+	}
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// ValidateQuietHours 检查免打扰设置，供设置接口在保存前调用
+func ValidateQuietHours(q config.QuietHours) error {
+	if !q.Enabled {
+		return nil
+	}
+	start, err := clockMinutes(q.Start)
+	if err != nil {
+		return err
+	}
+	end, err := clockMinutes(q.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return errors.New("start and end must differ")
+	}
+	_, err = quietLocation(q)
+	return err
+}
+
+// InQuietHours 判断 t 是否落在免打扰时段内，设置无效时视为不在时段内
+func InQuietHours(q config.QuietHours, t time.Time) bool {
+	if !q.Enabled {
+		return false
+	}
+	start, err1 := clockMinutes(q.Start)
+	end, err2 := clockMinutes(q.End)
+	loc, err3 := quietLocation(q)
+	if err1 != nil || err2 != nil || err3 != nil || start == end {
+		return false
+	}
+	t = t.In(loc)
+	m := t.Hour()*60 + t.Minute()
+	if start < end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// holdIfQuiet 在账号的免打扰时段内积压事件，返回 true 表示已积压；写入失败时照常发送
+func holdIfQuiet(e Event) bool {
+	email := config.NormalizeEmail(e.Email)
+	if email == "" {
+		return false
+	}
+	s, err := config.GetAccountSettings(email)
+	if err != nil {
+		log.Println("Error reading account settings:", err)
+		return false
+	}
+	if !InQuietHours(s.QuietHours, e.Time) {
+		return false
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Println("Error marshaling held notification:", err)
+		return false
+	}
+	key := heldPrefix + email
+	if err := db.RedisRPush(key, string(b)).Err(); err != nil {
+		log.Println("Error holding notification, sending now:", err)
+		return false
+	}
+	_ = db.RedisLTrim(key, -heldMax, -1).Err()
+	_ = db.RedisExpire(key, heldTTL).Err()
+	return true
+}
+
+// HeldCount 返回账号当前积压的通知数量
+func HeldCount(email string) (int64, error) {
+	return db.RedisLLen(heldPrefix + config.NormalizeEmail(email)).Result()
+}
+
+// StartQuietHours 每分钟检查一次，发出免打扰已结束的账号积压的通知
+func StartQuietHours() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, key := range db.RedisGetAllMatchedKeys(heldPrefix + "*") {
+			email := strings.TrimPrefix(key, heldPrefix)
+			s, err := config.GetAccountSettings(email)
+			if err != nil {
+				log.Println("Error reading account settings:", err)
+				continue
+			}
+			if InQuietHours(s.QuietHours, now) {
+				continue
+			}
+			if n, err := FlushHeld(email); err != nil {
+				log.Println("Error flushing held notifications:", email, err)
+			} else if n > 0 {
+				log.Println("Held notifications sent:", email, n)
+			}
+		}
+	}
+}
+
+// FlushHeld 立即按渠道合并发出账号积压的通知，返回积压的数量
+func FlushHeld(email string) (int, error) {
+	email = config.NormalizeEmail(email)
+	key := heldPrefix + email
+	// 先改名再读取，多实例同时处理时只有一个能拿到
+	tmp := fmt.Sprintf("%s%s:%d", flushingPrefix, email, time.Now().UnixNano())
+	if err := db.RedisRename(key, tmp).Err(); err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return 0, nil
+		}
+		return 0, err
+	}
+	vals, err := db.RedisLRange(tmp, 0, -1).Result()
+	_ = db.RedisDel(tmp).Err()
+	if err != nil {
+		return 0, err
+	}
+
+	// 合并消息中的时间按账号免打扰的时区展示
+	loc := time.Local
+	if s, err := config.GetAccountSettings(email); err == nil {
+		if l, err := quietLocation(s.QuietHours); err == nil {
+			loc = l
+		}
+	}
+	held := make([]Event, 0, len(vals))
+	for _, v := range vals {
+		var e Event
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			log.Println("Error parsing held notification:", err)
+			continue
+		}
+		e.Time = e.Time.In(loc)
+		held = append(held, e)
+	}
+	sort.SliceStable(held, func(i, j int) bool { return held[i].Time.Before(held[j].Time) })
+
+	now := time.Now()
+	for _, ch := range Channels(email) {
+		var items []Event
+		for _, e := range held {
+			if Wants(ch, e.Type) {
+				items = append(items, e)
+			}
+		}
+		switch len(items) {
+		case 0:
+		case 1:
+			go Send(ch, items[0])
+		default:
+			go Send(ch, Event{Type: EventBatch, Time: now, Email: email, Batch: items})
+		}
+	}
+	return len(held), nil
+}
+
+func batchFacts(e Event) []Fact {
+	out := make([]Fact, 0, len(e.Batch))
+	for _, item := range e.Batch {
+		out = append(out, Fact{item.Time.Format("01-02 15:04"), item.Title()})
+	}
+	return out
+}
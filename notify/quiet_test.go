@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/config"
+)
+
+func TestValidateQuietHours(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       config.QuietHours
+		wantErr bool
+	}{
+		{"disabled ignores bad values", config.QuietHours{Start: "nope", End: "25:00"}, false},
+		{"same day", config.QuietHours{Enabled: true, Start: "12:00", End: "14:00"}, false},
+		{"past midnight", config.QuietHours{Enabled: true, Start: "23:00", End: "07:00"}, false},
+		{"spaces trimmed", config.QuietHours{Enabled: true, Start: " 23:00 ", End: "07:00"}, false},
+		{"with timezone", config.QuietHours{Enabled: true, Start: "23:00", End: "07:00", Timezone: "Asia/Shanghai"}, false},
+		{"start equals end", config.QuietHours{Enabled: true, Start: "08:00", End: "08:00"}, true},
+		{"bad start", config.QuietHours{Enabled: true, Start: "8am", End: "09:00"}, true},
+		{"hour out of range", config.QuietHours{Enabled: true, Start: "22:00", End: "24:00"}, true},
+		{"empty end", config.QuietHours{Enabled: true, Start: "22:00"}, true},
+		{"unknown timezone", config.QuietHours{Enabled: true, Start: "23:00", End: "07:00", Timezone: "Mars/Base"}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateQuietHours(tt.q); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	at := func(hour, min int) time.Time { return time.Date(2024, 3, 1, hour, min, 0, 0, shanghai) }
+	day := config.QuietHours{Enabled: true, Start: "12:00", End: "14:00", Timezone: "Asia/Shanghai"}
+	night := config.QuietHours{Enabled: true, Start: "23:00", End: "07:00", Timezone: "Asia/Shanghai"}
+
+	tests := []struct {
+		name string
+		q    config.QuietHours
+		t    time.Time
+		want bool
+	}{
+		{"start < end: before", day, at(11, 59), false},
+		{"start < end: start minute included", day, at(12, 0), true},
+		{"start < end: inside", day, at(13, 30), true},
+		{"start < end: last minute", day, at(13, 59), true},
+		{"start < end: end minute excluded", day, at(14, 0), false},
+		{"wrap: before start", night, at(22, 59), false},
+		{"wrap: start minute included", night, at(23, 0), true},
+		{"wrap: midnight", night, at(0, 0), true},
+		{"wrap: early morning", night, at(6, 59), true},
+		{"wrap: end minute excluded", night, at(7, 0), false},
+		{"wrap: afternoon", night, at(15, 0), false},
+		// 同一时刻按设置的时区换算：UTC 15:30 是上海 23:30
+		{"timezone converts", night, time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC), true},
+		{"timezone converts outside", night, time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC), false},
+		{"disabled", config.QuietHours{Start: "00:00", End: "23:59", Timezone: "Asia/Shanghai"}, at(12, 0), false},
+		{"start equals end", config.QuietHours{Enabled: true, Start: "12:00", End: "12:00", Timezone: "Asia/Shanghai"}, at(12, 0), false},
+		{"invalid time", config.QuietHours{Enabled: true, Start: "noon", End: "14:00", Timezone: "Asia/Shanghai"}, at(13, 0), false},
+		{"invalid timezone", config.QuietHours{Enabled: true, Start: "12:00", End: "14:00", Timezone: "Mars/Base"}, at(13, 0), false},
+	}
+	for _, tt := range tests {
+		if got := InQuietHours(tt.q, tt.t); got != tt.want {
+			t.Errorf("%s: InQuietHours(%s) = %v, want %v", tt.name, tt.t.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
+
+// 账号没有设置时区时按 digest.timezone 换算
+func TestInQuietHoursDigestTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Shanghai"); err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	saved := viper.Get("digest.timezone")
+	viper.Set("digest.timezone", "Asia/Shanghai")
+	t.Cleanup(func() { viper.Set("digest.timezone", saved) })
+
+	q := config.QuietHours{Enabled: true, Start: "23:00", End: "07:00"}
+	if !InQuietHours(q, time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC)) {
+		t.Error("UTC 15:30 should be 23:30 in digest.timezone")
+	}
+	if InQuietHours(q, time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC)) {
+		t.Error("UTC 00:30 should be 08:30 in digest.timezone")
+	}
+}
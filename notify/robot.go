@@ -0,0 +1,217 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"wzj_signin/config"
+)
+
+// 企业微信、钉钉、飞书的群机器人：target 为机器人 webhook 地址；
+// 钉钉与飞书开启“加签”时把密钥填在 secret。
+func init() {
+	Register("wecom", newRobot("wecom"))
+	Register("dingtalk", newRobot("dingtalk"))
+	Register("feishu", newRobot("feishu"))
+}
+
+type robotNotifier struct {
+	kind   string
+	url    string
+	secret string
+}
+
+func newRobot(kind string) Factory {
+	return func(ch config.NotifyChannel) (Notifier, error) {
+		u, err := url.Parse(ch.Target)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("%s channel requires the robot webhook URL as target", kind)
+		}
+		return &robotNotifier{kind: kind, url: ch.Target, secret: strings.TrimSpace(ch.Secret)}, nil
+	}
+}
+
+func (n *robotNotifier) Name() string { return n.kind }
+
+func (n *robotNotifier) Notify(ctx context.Context, e Event) error {
+	var payload interface{}
+	target := n.url
+	switch n.kind {
+	case "wecom":
+		payload = wecomPayload(e)
+	case "dingtalk":
+		payload = dingtalkPayload(e)
+		if n.secret != "" {
+			ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+			sep := "?"
+			if strings.Contains(target, "?") {
+				sep = "&"
+			}
+			target += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(dingtalkSign(ts, n.secret))
+		}
+	case "feishu":
+		p := feishuPayload(e)
+		if n.secret != "" {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			p["timestamp"] = ts
+			p["sign"] = feishuSign(ts, n.secret)
+		}
+		payload = p
+	}
+
+	body, err := postJSON(ctx, target, nil, payload)
+	if err != nil {
+		return err
+	}
+	return robotError(body)
+}
+
+// 三家都在 HTTP 200 的响应体里返回错误码：errcode（企业微信/钉钉）或 code（飞书）
+func robotError(body []byte) error {
+	var r struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil
+	}
+	if r.ErrCode != nil && *r.ErrCode != 0 {
+		return fmt.Errorf("errcode %d: %s", *r.ErrCode, r.ErrMsg)
+	}
+	if r.Code != nil && *r.Code != 0 {
+		return fmt.Errorf("code %d: %s", *r.Code, r.Msg)
+	}
+	return nil
+}
+
+// 钉钉加签：HmacSHA256(timestamp + "\n" + secret)，密钥为 secret
+func dingtalkSign(ts string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 飞书加签：以 timestamp + "\n" + secret 为密钥对空串做 HmacSHA256
+func feishuSign(ts string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(ts+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// robotMarkdown 生成三家通用的 markdown 正文
+func robotMarkdown(e Event, heading string) string {
+	var b strings.Builder
+	if heading != "" {
+		b.WriteString(heading + "\n")
+	}
+	for _, f := range e.Facts() {
+		fmt.Fprintf(&b, "**%s**：%s\n", f.Label, f.Value)
+	}
+	if e.Type == EventFailed && e.Message != "" {
+		fmt.Fprintf(&b, "> %s\n", e.Message)
+	}
+	for _, line := range digestLines(e.Digest) {
+		b.WriteString("- " + line + "\n")
+	}
+	if e.QrPage != "" {
+		fmt.Fprintf(&b, "[打开二维码页扫码签到](%s)\n", e.QrPage)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func wecomPayload(e Event) map[string]interface{} {
+	color := "info"
+	if e.Type == EventQRRequired || e.Type == EventFailed || e.Type == EventExpired {
+		color = "warning"
+	}
+	heading := fmt.Sprintf(`<font color="%s">%s</font>`, color, e.Title())
+	return map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"content": robotMarkdown(e, heading)},
+	}
+}
+
+func dingtalkPayload(e Event) map[string]interface{} {
+	text := robotMarkdown(e, "### "+e.Title())
+	if e.QrPage != "" {
+		// 二维码提醒用 ActionCard，按钮直接打开二维码页
+		return map[string]interface{}{
+			"msgtype": "actionCard",
+			"actionCard": map[string]string{
+				"title":       e.Title(),
+				"text":        text,
+				"singleTitle": "打开二维码页",
+				"singleURL":   e.QrPage,
+			},
+		}
+	}
+	return map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": e.Title(), "text": text},
+	}
+}
+
+func feishuPayload(e Event) map[string]interface{} {
+	template := "green"
+	switch e.Type {
+	case EventQRRequired:
+		template = "red"
+	case EventFailed, EventExpired:
+		template = "orange"
+	case EventDetected:
+		template = "blue"
+	}
+
+	var fields []interface{}
+	for _, f := range e.Facts() {
+		fields = append(fields, map[string]interface{}{
+			"is_short": len([]rune(f.Value)) <= 16,
+			"text":     map[string]string{"tag": "lark_md", "content": "**" + f.Label + "**\n" + f.Value},
+		})
+	}
+	elements := []interface{}{
+		map[string]interface{}{"tag": "div", "fields": fields},
+	}
+	if e.Type == EventFailed && e.Message != "" {
+		elements = append(elements, map[string]interface{}{
+			"tag":  "div",
+			"text": map[string]string{"tag": "plain_text", "content": e.Message},
+		})
+	}
+	if lines := digestLines(e.Digest); len(lines) > 0 {
+		elements = append(elements, map[string]interface{}{
+			"tag":  "div",
+			"text": map[string]string{"tag": "plain_text", "content": strings.Join(lines, "\n")},
+		})
+	}
+	if e.QrPage != "" {
+		elements = append(elements, map[string]interface{}{
+			"tag": "action",
+			"actions": []interface{}{map[string]interface{}{
+				"tag":  "button",
+				"type": "danger",
+				"text": map[string]string{"tag": "plain_text", "content": "打开二维码页扫码"},
+				"url":  e.QrPage,
+			}},
+		})
+	}
+	return map[string]interface{}{
+		"msg_type": "interactive",
+		"card": map[string]interface{}{
+			"header": map[string]interface{}{
+				"template": template,
+				"title":    map[string]string{"tag": "plain_text", "content": e.Title()},
+			},
+			"elements": elements,
+		},
+	}
+}
@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"wzj_signin/config"
+)
+
+// 两家文档只给出加签示例代码、没有给出固定输入的结果，期望值是照文档示例代码（Python 版）另行算出的
+func TestDingtalkSign(t *testing.T) {
+	tests := []struct{ ts, secret, want string }{
+		{"1577262236757", "SECb4a0e4d3f4b0e8cd8a3b1f2c5f0e6a7d", "GxK1YWnOPEOyXl5M+I6iNnqzOAO45tmEQfonBjUTQmc="},
+	}
+	for _, tt := range tests {
+		got := dingtalkSign(tt.ts, tt.secret)
+		if got != tt.want {
+			t.Errorf("dingtalkSign(%s, %s) = %s, want %s", tt.ts, tt.secret, got, tt.want)
+		}
+		// 文档要求放进 URL 前做 urlEncode
+		if want := "GxK1YWnOPEOyXl5M%2BI6iNnqzOAO45tmEQfonBjUTQmc%3D"; url.QueryEscape(got) != want {
+			t.Errorf("escaped sign = %s, want %s", url.QueryEscape(got), want)
+		}
+	}
+}
+
+func TestFeishuSign(t *testing.T) {
+	tests := []struct{ ts, secret, want string }{
+		{"1599360473", "demo", "l1N0gAcBjdwBvGm1xMjOF0XSyaLRpR7tuO5dHfhAYc8="},
+	}
+	for _, tt := range tests {
+		if got := feishuSign(tt.ts, tt.secret); got != tt.want {
+			t.Errorf("feishuSign(%s, %s) = %s, want %s", tt.ts, tt.secret, got, tt.want)
+		}
+	}
+}
+
+// 加签参数按各家要求放在 URL（钉钉）或请求体（飞书）里
+func TestRobotSignedRequest(t *testing.T) {
+	var (
+		query url.Values
+		body  map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		b, _ := io.ReadAll(r.Body)
+		body = nil
+		_ = json.Unmarshal(b, &body)
+		_, _ = io.WriteString(w, `{"errcode":0,"code":0}`)
+	}))
+	defer srv.Close()
+
+	e := Event{Type: EventSigned, CourseName: "高数"}
+
+	ding := &robotNotifier{kind: "dingtalk", url: srv.URL + "?access_token=tok", secret: "SECxyz"}
+	if err := ding.Notify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("access_token") != "tok" || query.Get("timestamp") == "" ||
+		query.Get("sign") != dingtalkSign(query.Get("timestamp"), "SECxyz") {
+		t.Errorf("dingtalk query = %v", query)
+	}
+
+	feishu := &robotNotifier{kind: "feishu", url: srv.URL, secret: "demo"}
+	if err := feishu.Notify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := body["timestamp"].(string)
+	if ts == "" || body["sign"] != feishuSign(ts, "demo") {
+		t.Errorf("feishu body timestamp = %v, sign = %v", body["timestamp"], body["sign"])
+	}
+}
+
+func TestRobotError(t *testing.T) {
+	tests := []struct {
+		body    string
+		wantErr bool
+	}{
+		{`{"errcode":0,"errmsg":"ok"}`, false},
+		{`{"errcode":310000,"errmsg":"sign not match"}`, true},
+		{`{"code":0,"msg":"success"}`, false},
+		{`{"code":19021,"msg":"sign match fail"}`, true},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		if err := robotError([]byte(tt.body)); (err != nil) != tt.wantErr {
+			t.Errorf("robotError(%s) = %v, wantErr %v", tt.body, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewRobotRequiresHTTPS(t *testing.T) {
+	for _, target := range []string{"", "http://oapi.dingtalk.com/robot/send?access_token=x", "oapi.dingtalk.com"} {
+		if _, err := newRobot("dingtalk")(config.NotifyChannel{Target: target}); err == nil {
+			t.Errorf("target %q accepted", target)
+		}
+	}
+	if _, err := newRobot("wecom")(config.NotifyChannel{Target: "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=k"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"wzj_signin/config"
+	"wzj_signin/db"
+	"wzj_signin/qr"
+	"wzj_signin/telegram"
+)
+
+func init() {
+	Register("telegram", newTelegram)
+}
+
+// telegramNotifier 通过全局配置的 Bot 发送到 target（chat id）。
+// 二维码提醒会附上当前二维码图片（二维码会轮换，图片仅供快速转发，以二维码页为准）。
+type telegramNotifier struct {
+	chatID string
+}
+
+func newTelegram(ch config.NotifyChannel) (Notifier, error) {
+	if strings.TrimSpace(ch.Target) == "" {
+		return nil, errors.New("telegram channel requires a chat id target")
+	}
+	return &telegramNotifier{chatID: strings.TrimSpace(ch.Target)}, nil
+}
+
+func (n *telegramNotifier) Name() string { return "telegram:" + n.chatID }
+
+func (n *telegramNotifier) Notify(ctx context.Context, e Event) error {
+	client, ok := telegram.FromConfig()
+	if !ok {
+		return errors.New("telegram bot is not configured")
+	}
+	text := e.Title() + "\n" + e.Text()
+
+	if e.Type == EventQRRequired && e.SignId > 0 {
+		if qrUrl := waitQrUrl(ctx, e.SignId, 10*time.Second); qrUrl != "" {
+			png, err := qr.RenderPNG(qrUrl, qr.DefaultImageOptions())
+			if err == nil {
+				// 图片说明最多 1024 个字符
+				caption := []rune(text)
+				if len(caption) > 1000 {
+					caption = append(caption[:1000], '…')
+				}
+				err = client.SendPhoto(ctx, n.chatID, png, string(caption))
+				if err == nil {
+					return nil
+				}
+				log.Println("Telegram sendPhoto failed, falling back to text:", err)
+			}
+		}
+	}
+	return client.SendMessage(ctx, n.chatID, text)
+}
+
+// 二维码提醒通常与 WS 订阅同时发出，稍等第一张二维码到达
+func waitQrUrl(ctx context.Context, signId int, wait time.Duration) string {
+	deadline := time.Now().Add(wait)
+	for {
+		if v, err := db.RedisGet(fmt.Sprintf("wzj:qr:%d", signId)).Result(); err == nil && v != "" {
+			return v
+		}
+		if time.Now().After(deadline) {
+			return ""
+		}
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
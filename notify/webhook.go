@@ -0,0 +1,243 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"wzj_signin/config"
+	"wzj_signin/db"
+)
+
+func init() {
+	Register("webhook", newWebhook)
+}
+
+// 重试耗尽的 webhook 请求写入这个 Redis 列表，供管理接口查看
+const (
+	deadLetterKey = "wzj:webhook:deadletter"
+	deadLetterMax = 200
+)
+
+// SignatureHeader 携带请求体的 HMAC-SHA256 签名：sha256=<hex>
+const SignatureHeader = "X-Wzj-Signature-256"
+
+var (
+	// webhookBackoff 是第一次重试前的等待时间，之后每次翻倍
+	webhookBackoff = time.Second
+	// saveDeadLetter 保存一条投递失败的记录，默认写入 Redis 列表
+	saveDeadLetter = pushDeadLetter
+)
+
+// webhookNotifier 把事件 POST 到 target。
+// template 为 text/template 请求体模板，数据为 Event（可用 {{.Title}}、{{.Text}}、{{json .CourseName}} 等），
+// 留空时发送 Event 的 JSON。secret 非空时附带签名头。
+// options：timeout_seconds（默认 10）、retries（失败后重试次数，默认 3）、content_type（默认 application/json）。
+type webhookNotifier struct {
+	id          string
+	url         string
+	secret      string
+	tmpl        *template.Template
+	timeout     time.Duration
+	retries     int
+	contentType string
+}
+
+// DeadLetter 是一条投递失败的 webhook 记录
+type DeadLetter struct {
+	Time     time.Time `json:"time"`
+	Channel  string    `json:"channel"`
+	Email    string    `json:"email"`
+	URL      string    `json:"url"`
+	Event    string    `json:"event"`
+	Body     string    `json:"body"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+}
+
+var templateFuncs = template.FuncMap{
+	// json 把值编码为 JSON 字面量，字符串会带引号并转义，便于拼接 JSON 模板
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func newWebhook(ch config.NotifyChannel) (Notifier, error) {
+	u, err := url.Parse(ch.Target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("webhook channel requires an http(s) target URL")
+	}
+	n := &webhookNotifier{
+		id:          ch.ID,
+		url:         ch.Target,
+		secret:      ch.Secret,
+		timeout:     10 * time.Second,
+		retries:     3,
+		contentType: "application/json",
+	}
+	if strings.TrimSpace(ch.Template) != "" {
+		t, err := template.New(ch.ID).Funcs(templateFuncs).Option("missingkey=error").Parse(ch.Template)
+		if err != nil {
+			return nil, fmt.Errorf("parse template: %w", err)
+		}
+		// 用空事件试渲染一次，提前发现拼错的字段名
+		if err := t.Execute(io.Discard, Event{}); err != nil {
+			return nil, fmt.Errorf("template: %w", err)
+		}
+		n.tmpl = t
+	}
+	if v := ch.Options["timeout_seconds"]; v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs <= 0 {
+			return nil, errors.New("timeout_seconds must be a positive integer")
+		}
+		n.timeout = time.Duration(secs) * time.Second
+	}
+	if v := ch.Options["retries"]; v != "" {
+		retries, err := strconv.Atoi(v)
+		if err != nil || retries < 0 || retries > 10 {
+			return nil, errors.New("retries must be between 0 and 10")
+		}
+		n.retries = retries
+	}
+	if v := strings.TrimSpace(ch.Options["content_type"]); v != "" {
+		n.contentType = v
+	}
+	return n, nil
+}
+
+func (n *webhookNotifier) Name() string { return "webhook:" + n.id }
+
+func (n *webhookNotifier) render(e Event) ([]byte, error) {
+	if n.tmpl == nil {
+		payload := struct {
+			Event
+			Title string `json:"title"`
+			Text  string `json:"text"`
+		}{e, e.Title(), e.Text()}
+		return json.Marshal(payload)
+	}
+	var buf bytes.Buffer
+	if err := n.tmpl.Execute(&buf, e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign 计算请求体签名，接收方用同一个 secret 校验
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, e Event) error {
+	body, err := n.render(e)
+	if err != nil {
+		n.deadLetter(e, "", 0, fmt.Errorf("render template: %w", err))
+		return err
+	}
+
+	attempts := 0
+	backoff := webhookBackoff
+	for {
+		attempts++
+		err = n.post(ctx, e, body)
+		if err == nil {
+			return nil
+		}
+		if attempts > n.retries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	n.deadLetter(e, string(body), attempts, err)
+	return err
+}
+
+func (n *webhookNotifier) post(ctx context.Context, e Event, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", n.contentType)
+	req.Header.Set("User-Agent", "wzj-signin-webhook")
+	req.Header.Set("X-Wzj-Event", e.Type)
+	if n.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.secret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (n *webhookNotifier) deadLetter(e Event, body string, attempts int, cause error) {
+	saveDeadLetter(DeadLetter{
+		Time:     time.Now(),
+		Channel:  n.id,
+		Email:    e.Email,
+		URL:      n.url,
+		Event:    e.Type,
+		Body:     body,
+		Attempts: attempts,
+		Error:    cause.Error(),
+	})
+}
+
+func pushDeadLetter(d DeadLetter) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return
+	}
+	if err := db.RedisLPush(deadLetterKey, string(b)).Err(); err != nil {
+		log.Println("Error writing webhook dead letter:", err)
+		return
+	}
+	_ = db.RedisLTrim(deadLetterKey, 0, deadLetterMax-1).Err()
+}
+
+// DeadLetters 返回最近投递失败的 webhook，新的在前
+func DeadLetters(limit int) ([]DeadLetter, error) {
+	if limit <= 0 || limit > deadLetterMax {
+		limit = deadLetterMax
+	}
+	vals, err := db.RedisLRange(deadLetterKey, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DeadLetter, 0, len(vals))
+	for _, v := range vals {
+		var d DeadLetter
+		if json.Unmarshal([]byte(v), &d) == nil {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"wzj_signin/config"
+)
+
+func init() {
+	webhookBackoff = time.Millisecond
+}
+
+// receiver 是记录每次请求的 webhook 接收方，前 fail 次返回 500
+type receiver struct {
+	mu       sync.Mutex
+	fail     int
+	bodies   []string
+	headers  []http.Header
+	requests int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	r.bodies = append(r.bodies, string(body))
+	r.headers = append(r.headers, req.Header.Clone())
+	if r.requests <= r.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// captureDeadLetters 把死信记到切片里，测试结束后恢复
+func captureDeadLetters(t *testing.T) *[]DeadLetter {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		letters []DeadLetter
+	)
+	saved := saveDeadLetter
+	saveDeadLetter = func(d DeadLetter) {
+		mu.Lock()
+		letters = append(letters, d)
+		mu.Unlock()
+	}
+	t.Cleanup(func() { saveDeadLetter = saved })
+	return &letters
+}
+
+func testWebhook(t *testing.T, ch config.NotifyChannel) Notifier {
+	t.Helper()
+	if ch.ID == "" {
+		ch.ID = "webhook"
+	}
+	n, err := newWebhook(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+var webhookEvent = Event{Type: EventSigned, Email: "a@example.com", OpenId: "oid", CourseId: 12, SignId: 34, CourseName: "高数", Mode: "gps", StudentRank: 3, SignRank: 9}
+
+func TestWebhookBodyAndSignature(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	letters := captureDeadLetters(t)
+
+	n := testWebhook(t, config.NotifyChannel{Target: srv.URL, Secret: "s3cret"})
+	if err := n.Notify(context.Background(), webhookEvent); err != nil {
+		t.Fatal(err)
+	}
+	if r.requests != 1 || len(*letters) != 0 {
+		t.Fatalf("requests = %d, dead letters = %d", r.requests, len(*letters))
+	}
+
+	body := r.bodies[0]
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("body is not JSON: %v\n%s", err, body)
+	}
+	for key, want := range map[string]interface{}{
+		"type": EventSigned, "courseName": "高数", "courseId": 12.0, "signId": 34.0, "studentRank": 3.0,
+		"title": webhookEvent.Title(), "text": webhookEvent.Text(),
+	} {
+		if got[key] != want {
+			t.Errorf("body[%q] = %v, want %v", key, got[key], want)
+		}
+	}
+
+	h := r.headers[0]
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(body))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); h.Get(SignatureHeader) != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, h.Get(SignatureHeader), want)
+	}
+	if h.Get("X-Wzj-Event") != EventSigned || h.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", h)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n := testWebhook(t, config.NotifyChannel{
+		Target:   srv.URL,
+		Template: `{"course":{{json .CourseName}},"id":{{.CourseId}},"rank":{{.StudentRank}}}`,
+		Options:  map[string]string{"content_type": "text/plain"},
+	})
+	if err := n.Notify(context.Background(), webhookEvent); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"course":"高数","id":12,"rank":3}`; r.bodies[0] != want {
+		t.Errorf("body = %s, want %s", r.bodies[0], want)
+	}
+	if r.headers[0].Get(SignatureHeader) != "" {
+		t.Error("signature sent without a secret")
+	}
+	if r.headers[0].Get("Content-Type") != "text/plain" {
+		t.Errorf("Content-Type = %q", r.headers[0].Get("Content-Type"))
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		fail         int
+		retries      string
+		wantRequests int
+		wantDead     bool
+	}{
+		{"succeeds after retries", 2, "2", 3, false},
+		{"retries exhausted", 100, "2", 3, true},
+		{"no retries", 100, "0", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &receiver{fail: tt.fail}
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+			letters := captureDeadLetters(t)
+
+			n := testWebhook(t, config.NotifyChannel{Target: srv.URL, Secret: "s3cret", Options: map[string]string{"retries": tt.retries}})
+			err := n.Notify(context.Background(), webhookEvent)
+			if (err != nil) != tt.wantDead {
+				t.Fatalf("Notify error = %v", err)
+			}
+			if r.requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", r.requests, tt.wantRequests)
+			}
+			if !tt.wantDead {
+				if len(*letters) != 0 {
+					t.Errorf("unexpected dead letters %+v", *letters)
+				}
+				return
+			}
+			if len(*letters) != 1 {
+				t.Fatalf("dead letters = %d, want 1", len(*letters))
+			}
+			d := (*letters)[0]
+			if d.Attempts != tt.wantRequests || d.Error != "HTTP 500" || d.Body != r.bodies[0] ||
+				d.URL != srv.URL || d.Event != EventSigned || d.Email != "a@example.com" || d.Channel != "webhook" {
+				t.Errorf("dead letter = %+v", d)
+			}
+		})
+	}
+}
+
+// GitHub webhook 文档中的示例：同样是 HMAC-SHA256 + sha256= 前缀
+func TestSign(t *testing.T) {
+	got := Sign("It's a Secret to Everybody", []byte("Hello, World!"))
+	if want := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"; got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
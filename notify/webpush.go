@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/config"
+	"wzj_signin/webpush"
+)
+
+func init() {
+	Register("webpush", newWebPush)
+}
+
+// webPushNotifier 推送到浏览器订阅：target 为订阅地址，options 中的 p256dh / auth 为订阅密钥。
+// 订阅由前端通过 /api/webpush/subscribe 写入，一般不需要手动配置。
+type webPushNotifier struct {
+	id  string
+	sub webpush.Subscription
+}
+
+// WebPushSubscription 把渠道配置还原为浏览器订阅
+func WebPushSubscription(ch config.NotifyChannel) webpush.Subscription {
+	var sub webpush.Subscription
+	sub.Endpoint = strings.TrimSpace(ch.Target)
+	sub.Keys.P256dh = ch.Options["p256dh"]
+	sub.Keys.Auth = ch.Options["auth"]
+	return sub
+}
+
+func newWebPush(ch config.NotifyChannel) (Notifier, error) {
+	sub := WebPushSubscription(ch)
+	if err := sub.Validate(); err != nil {
+		return nil, err
+	}
+	return &webPushNotifier{id: ch.ID, sub: sub}, nil
+}
+
+func (n *webPushNotifier) Name() string {
+	if u, err := url.Parse(n.sub.Endpoint); err == nil {
+		return "webpush:" + u.Host
+	}
+	return "webpush"
+}
+
+// webPushSubject 是 VAPID 的联系方式，推送服务在滥用时据此联系管理员
+func webPushSubject() string {
+	if s := strings.TrimSpace(viper.GetString("webpush.subject")); s != "" {
+		return s
+	}
+	if from := strings.TrimSpace(viper.GetString("mail.from")); from != "" {
+		return "mailto:" + from
+	}
+	return viper.GetString("app.url")
+}
+
+func (n *webPushNotifier) Notify(ctx context.Context, e Event) error {
+	keys, err := config.GetVAPIDKeys()
+	if err != nil {
+		return err
+	}
+	key, err := keys.ECDSA()
+	if err != nil {
+		return err
+	}
+
+	link := e.QrPage
+	if link == "" {
+		link = strings.TrimRight(viper.GetString("app.url"), "/") + "/history"
+	}
+	payload := map[string]interface{}{
+		"title": e.Title(),
+		"body":  e.Text(),
+		"url":   link,
+		"type":  e.Type,
+	}
+	opt := webpush.Options{
+		Subject:   webPushSubject(),
+		PublicKey: keys.PublicKey,
+		Key:       key,
+		TTL:       24 * time.Hour,
+		Urgency:   [...]string{"low", "normal", "high", "high"}[priorityOf(e)],
+	}
+	if e.Type == EventQRRequired {
+		// 二维码签到很快结束，过时的提醒没有意义；同一签到的新提醒替换尚未送达的旧提醒
+		opt.TTL = time.Duration(viper.GetInt("qr.max_lifetime_minutes")) * time.Minute
+		opt.Topic = fmt.Sprintf("qr-%d", e.SignId)
+		payload["tag"] = opt.Topic
+		payload["requireInteraction"] = true
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if len(b) > webpush.MaxPayload {
+		if text := []rune(e.Text()); len(text) > 200 {
+			payload["body"] = string(text[:200]) + "…"
+		}
+		if b, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+
+	err = webpush.Send(ctx, nil, n.sub, b, opt)
+	if errors.Is(err, webpush.ErrGone) && e.Email != "" {
+		if rmErr := RemoveWebPush(e.Email, n.sub.Endpoint); rmErr != nil {
+			log.Println("Error removing expired push subscription:", rmErr)
+		}
+	}
+	return err
+}
+
+// RemoveWebPush 从账号的通知渠道中删除该浏览器订阅
+func RemoveWebPush(email string, endpoint string) error {
+	s, err := config.GetAccountSettings(email)
+	if err != nil {
+		return err
+	}
+	channels := s.Channels[:0]
+	for _, ch := range s.Channels {
+		if ch.Type == "webpush" && ch.Target == endpoint {
+			continue
+		}
+		channels = append(channels, ch)
+	}
+	if len(channels) == len(s.Channels) {
+		return nil
+	}
+	s.Channels = channels
+	_, err = config.UpdateAccountSettings(s)
+	return err
+}
@@ -0,0 +1,175 @@
+package qr
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/bayeux"
+	"wzj_signin/db"
+)
+
+// 每个订阅记录一条时间线（握手、订阅确认、每次二维码轮换、断线、错误、结束原因），
+// 存在 Redis 列表 wzj:qr:audit:<id>，wzj:qr:audit:index 保留最近 qr.audit.keep 个订阅。
+const (
+	auditIndexKey   = "wzj:qr:audit:index"
+	auditTTL        = 7 * 24 * time.Hour
+	auditMaxEntries = 2000
+	auditQueueSize  = 1024
+)
+
+// 时间线事件：除下列外，还会记录 bayeux 客户端事件（open/handshake/subscribe/unsubscribe/disconnect/error）
+const (
+	AuditStart    = "start"
+	AuditAccount  = "account" // 账号登记到该订阅，detail 为 OpenID
+	AuditRelease  = "release" // 账号的轮询结果里已没有该签到，移出订阅
+	AuditRotation = "rotation"
+	AuditStop     = "stop"
+)
+
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// AuditSummary 是管理接口列表中的一项
+type AuditSummary struct {
+	Key
+	ID         string     `json:"id"`
+	StartedAt  time.Time  `json:"startedAt"`
+	EndedAt    *time.Time `json:"endedAt,omitempty"`
+	StopReason string     `json:"stopReason,omitempty"`
+	Rotations  int        `json:"rotations"`
+	Errors     int        `json:"errors"`
+	Handshakes int        `json:"handshakes"`
+	LastEvent  string     `json:"lastEvent"`
+}
+
+type audit struct {
+	id  string
+	key Key
+}
+
+// 时间线由 add 放入队列、单个 goroutine 按顺序写入 Redis：调用方常持有 subMu，
+// 不能在锁内等待 Redis。队列满时丢弃并记日志，不阻塞调用方。
+type auditWrite struct {
+	id    string
+	index bool // 把 id 加入 wzj:qr:audit:index
+	entry string
+}
+
+var (
+	auditWrites     = make(chan auditWrite, auditQueueSize)
+	auditWriterOnce sync.Once
+)
+
+func queueAudit(w auditWrite) {
+	auditWriterOnce.Do(func() { go auditWriter() })
+	select {
+	case auditWrites <- w:
+	default:
+		log.Println("QR audit queue full, dropping:", w.id, w.entry)
+	}
+}
+
+func auditWriter() {
+	for w := range auditWrites {
+		if w.index {
+			keep := int64(viper.GetInt("qr.audit.keep"))
+			if err := db.RedisLPush(auditIndexKey, w.id).Err(); err != nil {
+				log.Println("Error indexing QR audit:", err)
+			}
+			_ = db.RedisLTrim(auditIndexKey, 0, keep-1).Err()
+			continue
+		}
+		k := auditKey(w.id)
+		if err := db.RedisRPush(k, w.entry).Err(); err != nil {
+			log.Println("Error writing QR audit:", err)
+			continue
+		}
+		_ = db.RedisLTrim(k, -auditMaxEntries, -1).Err()
+		_ = db.RedisExpire(k, auditTTL).Err()
+	}
+}
+
+func auditKey(id string) string {
+	return "wzj:qr:audit:" + id
+}
+
+func newAudit(key Key, startedAt time.Time, detail string) *audit {
+	a := &audit{id: fmt.Sprintf("%d-%d-%d", key.CourseId, key.SignId, startedAt.UnixMilli()), key: key}
+	if viper.GetInt("qr.audit.keep") > 0 {
+		queueAudit(auditWrite{id: a.id, index: true})
+	}
+	a.add(AuditStart, detail)
+	return a
+}
+
+func (a *audit) add(event string, detail string) {
+	if a == nil || viper.GetInt("qr.audit.keep") <= 0 {
+		return
+	}
+	b, err := json.Marshal(AuditEntry{Time: time.Now(), Event: event, Detail: detail})
+	if err != nil {
+		return
+	}
+	queueAudit(auditWrite{id: a.id, entry: string(b)})
+}
+
+// Audit 返回一个订阅的完整时间线
+func Audit(id string) ([]AuditEntry, error) {
+	vals, err := db.RedisLRange(auditKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AuditEntry, 0, len(vals))
+	for _, v := range vals {
+		var e AuditEntry
+		if json.Unmarshal([]byte(v), &e) == nil {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// Audits 返回最近 limit 个订阅的时间线摘要，新的在前
+func Audits(limit int) ([]AuditSummary, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	ids, err := db.RedisLRange(auditIndexKey, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AuditSummary, 0, len(ids))
+	for _, id := range ids {
+		entries, err := Audit(id)
+		if err != nil || len(entries) == 0 {
+			continue
+		}
+		s := AuditSummary{ID: id, StartedAt: entries[0].Time}
+		fmt.Sscanf(id, "%d-%d", &s.CourseId, &s.SignId)
+		for _, e := range entries {
+			switch e.Event {
+			case AuditRotation:
+				s.Rotations++
+			case bayeux.EventError:
+				s.Errors++
+			case bayeux.EventHandshake:
+				s.Handshakes++
+			case AuditStop:
+				t := e.Time
+				s.EndedAt = &t
+				s.StopReason = e.Detail
+			}
+		}
+		s.LastEvent = entries[len(entries)-1].Event
+		out = append(out, s)
+	}
+	return out, nil
+}
@@ -0,0 +1,127 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/viper"
+)
+
+// ImageOptions 控制二维码图片的渲染：Size 为边长像素，Margin 为静区宽度（单位：模块）
+type ImageOptions struct {
+	Size   int
+	Level  qrcode.RecoveryLevel
+	Margin int
+}
+
+// DefaultImageOptions 读取 qr.image.* 配置
+func DefaultImageOptions() ImageOptions {
+	level, ok := ParseLevel(viper.GetString("qr.image.level"))
+	if !ok {
+		level = qrcode.Medium
+	}
+	return ImageOptions{
+		Size:   viper.GetInt("qr.image.size"),
+		Level:  level,
+		Margin: viper.GetInt("qr.image.margin"),
+	}
+}
+
+// ParseLevel 解析纠错等级 L / M / Q / H
+func ParseLevel(s string) (qrcode.RecoveryLevel, bool) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "L":
+		return qrcode.Low, true
+	case "M":
+		return qrcode.Medium, true
+	case "Q":
+		return qrcode.High, true
+	case "H":
+		return qrcode.Highest, true
+	}
+	return qrcode.Medium, false
+}
+
+func LevelName(level qrcode.RecoveryLevel) string {
+	return [...]string{"L", "M", "Q", "H"}[level]
+}
+
+// 生成含静区的模块矩阵，true 表示黑色
+func modules(content string, opt ImageOptions) ([][]bool, error) {
+	q, err := qrcode.New(content, opt.Level)
+	if err != nil {
+		return nil, err
+	}
+	q.DisableBorder = true
+	bitmap := q.Bitmap()
+
+	n := len(bitmap) + 2*opt.Margin
+	out := make([][]bool, n)
+	for y := range out {
+		out[y] = make([]bool, n)
+	}
+	for y, row := range bitmap {
+		copy(out[y+opt.Margin][opt.Margin:], row)
+	}
+	return out, nil
+}
+
+func RenderPNG(content string, opt ImageOptions) ([]byte, error) {
+	mods, err := modules(content, opt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(mods)
+	size := opt.Size
+	if size < n {
+		size = n
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y := 0; y < size; y++ {
+		my := y * n / size
+		for x := 0; x < size; x++ {
+			if mods[my][x*n/size] {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func RenderSVG(content string, opt ImageOptions) ([]byte, error) {
+	mods, err := modules(content, opt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(mods)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, opt.Size, opt.Size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range mods {
+		for x := 0; x < n; x++ {
+			if !row[x] {
+				continue
+			}
+			// 合并同一行连续的黑色模块
+			start := x
+			for x < n && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
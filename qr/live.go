@@ -0,0 +1,112 @@
+package qr
+
+import (
+	"sync"
+	"time"
+)
+
+// Rotation 是一次二维码轮换，IntervalMs 为最近几次轮换的平均间隔（尚未观察到时为 0）
+type Rotation struct {
+	SignId     int       `json:"signId"`
+	QrURL      string    `json:"qrUrl"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	IntervalMs int64     `json:"intervalMs"`
+}
+
+// 每个 signId 的最新二维码与观看者，二维码页通过 Watch 实时接收轮换
+type liveSign struct {
+	last      Rotation
+	intervals []time.Duration
+	watchers  map[chan Rotation]struct{}
+}
+
+const intervalSamples = 5
+
+var (
+	liveMu sync.Mutex
+	lives  = map[int]*liveSign{}
+)
+
+func liveFor(signId int) *liveSign {
+	ls, ok := lives[signId]
+	if !ok {
+		ls = &liveSign{watchers: map[chan Rotation]struct{}{}}
+		lives[signId] = ls
+	}
+	return ls
+}
+
+// publish 由订阅处理函数调用，二维码变化时立即推给所有观看者
+func publish(signId int, qrUrl string) {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+
+	ls := liveFor(signId)
+	if ls.last.QrURL == qrUrl {
+		return
+	}
+	now := time.Now()
+	if !ls.last.ReceivedAt.IsZero() {
+		ls.intervals = append(ls.intervals, now.Sub(ls.last.ReceivedAt))
+		if len(ls.intervals) > intervalSamples {
+			ls.intervals = ls.intervals[len(ls.intervals)-intervalSamples:]
+		}
+	}
+	var sum time.Duration
+	for _, d := range ls.intervals {
+		sum += d
+	}
+	r := Rotation{SignId: signId, QrURL: qrUrl, ReceivedAt: now}
+	if len(ls.intervals) > 0 {
+		r.IntervalMs = (sum / time.Duration(len(ls.intervals))).Milliseconds()
+	}
+	ls.last = r
+
+	for ch := range ls.watchers {
+		// 只保留最新的一次：观看者来不及处理时丢掉旧的
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- r
+	}
+}
+
+// Watch 订阅 signId 的二维码轮换，返回当前最新一次（可能为空）。
+// 签到订阅结束时 channel 会被关闭。
+func Watch(signId int) (<-chan Rotation, Rotation, func()) {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+
+	ls := liveFor(signId)
+	ch := make(chan Rotation, 1)
+	ls.watchers[ch] = struct{}{}
+
+	cancel := func() {
+		liveMu.Lock()
+		defer liveMu.Unlock()
+		if _, ok := ls.watchers[ch]; ok {
+			delete(ls.watchers, ch)
+			close(ch)
+		}
+		if len(ls.watchers) == 0 && ls.last.QrURL == "" && lives[signId] == ls {
+			delete(lives, signId)
+		}
+	}
+	return ch, ls.last, cancel
+}
+
+// closeLive 在订阅结束时调用：通知观看者并清理轮换记录
+func closeLive(signId int) {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	ls, ok := lives[signId]
+	if !ok {
+		return
+	}
+	for ch := range ls.watchers {
+		delete(ls.watchers, ch)
+		close(ch)
+	}
+	delete(lives, signId)
+}
@@ -0,0 +1,258 @@
+package qr
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/device"
+	"wzj_signin/model"
+)
+
+// Key 标识一个二维码签到订阅
+type Key struct {
+	CourseId int `json:"courseId"`
+	SignId   int `json:"signId"`
+}
+
+// 订阅结束原因
+const (
+	StopLifetime   = "lifetime"    // 超过 qr.max_lifetime_minutes
+	StopSignClosed = "sign_closed" // 账号轮询结果里已经没有这个签到
+	StopNoViewers  = "no_viewers"  // 没有账号登记，二维码页也都关闭了
+	StopAdmin      = "admin"       // 管理接口手动停止
+	StopConfirmed  = "confirmed"   // 用户在二维码页确认已扫码
+	StopError      = "error"       // WS 连接异常退出
+)
+
+type subscription struct {
+	key       Key
+	device    string
+	transport string // 当前使用的 Bayeux 传输，握手成功前为空
+	startedAt time.Time
+	holders   map[string]time.Time // 登记该签到的 OpenID -> 登记时间
+	viewers   int                  // 打开中的二维码页数量
+	idleSince time.Time            // viewers 与 holders 都为空的起始时间
+	stop      chan struct{}
+	stopped   bool
+	audit     *audit
+}
+
+// SubscriptionInfo 是管理接口返回的订阅快照
+type SubscriptionInfo struct {
+	Key
+	Device    string    `json:"device"`
+	Transport string    `json:"transport"`
+	AuditID   string    `json:"auditId"`
+	StartedAt time.Time `json:"startedAt"`
+	Accounts  []string  `json:"accounts"`
+	Viewers   int       `json:"viewers"`
+}
+
+// OnStop 在订阅结束后调用（不持有锁，可再调用本包函数），info 为结束时的快照
+var OnStop func(info SubscriptionInfo, reason string)
+
+// OnRelease 在某个账号的轮询结果里不再有该签到、账号被移出订阅时调用（不持有锁）
+var OnRelease func(key Key, openId string)
+
+var (
+	subMu         sync.Mutex
+	subscriptions = map[Key]*subscription{}
+	watchdogOnce  sync.Once
+)
+
+func ensure(key Key, openId string, viewer bool, profile device.Profile) {
+	subMu.Lock()
+	defer subMu.Unlock()
+
+	sub, ok := subscriptions[key]
+	if !ok {
+		sub = &subscription{
+			key:       key,
+			device:    profile.Name,
+			startedAt: time.Now(),
+			holders:   map[string]time.Time{},
+			stop:      make(chan struct{}),
+		}
+		sub.audit = newAudit(key, sub.startedAt, "device="+profile.Name)
+		subscriptions[key] = sub
+		go run(sub, profile)
+		watchdogOnce.Do(func() { go watchdog() })
+	} else {
+		log.Println("QR WS reuse:", "courseId=", key.CourseId, "signId=", key.SignId)
+	}
+
+	if openId != "" {
+		if _, held := sub.holders[openId]; !held {
+			sub.holders[openId] = time.Now()
+			sub.audit.add(AuditAccount, openId)
+		}
+	}
+	if viewer {
+		sub.viewers++
+	}
+	sub.idleSince = time.Time{}
+}
+
+func run(sub *subscription, profile device.Profile) {
+	Start(sub.key.CourseId, sub.key.SignId, profile, sub.stop, Hooks{
+		Transport: func(name string) {
+			subMu.Lock()
+			defer subMu.Unlock()
+			if sub.transport != name {
+				log.Println("QR WS transport:", "signId=", sub.key.SignId, "transport=", name)
+			}
+			sub.transport = name
+		},
+		Event: sub.audit.add,
+	})
+
+	subMu.Lock()
+	defer subMu.Unlock()
+	if !sub.stopped {
+		// 连接自行退出（握手失败、服务端断开等）：从登记表移除，下次登记会重新建立
+		stopLocked(sub, StopError)
+	}
+}
+
+// AddViewer 二维码页打开时调用：复用或建立订阅，并增加观看计数
+func AddViewer(courseId int, signId int, profile device.Profile) {
+	ensure(Key{CourseId: courseId, SignId: signId}, "", true, profile)
+}
+
+// RemoveViewer 二维码页关闭时调用
+func RemoveViewer(courseId int, signId int) {
+	subMu.Lock()
+	defer subMu.Unlock()
+	if sub, ok := subscriptions[Key{CourseId: courseId, SignId: signId}]; ok && sub.viewers > 0 {
+		sub.viewers--
+	}
+}
+
+// Stop 结束订阅，返回是否存在该订阅
+func Stop(courseId int, signId int, reason string) bool {
+	subMu.Lock()
+	defer subMu.Unlock()
+	sub, ok := subscriptions[Key{CourseId: courseId, SignId: signId}]
+	if !ok {
+		return false
+	}
+	stopLocked(sub, reason)
+	return true
+}
+
+func stopLocked(sub *subscription, reason string) {
+	if sub.stopped {
+		return
+	}
+	sub.stopped = true
+	close(sub.stop)
+	sub.audit.add(AuditStop, reason)
+	if subscriptions[sub.key] == sub {
+		delete(subscriptions, sub.key)
+		closeLive(sub.key.SignId)
+	}
+	log.Println("QR subscription stopped:", "courseId=", sub.key.CourseId, "signId=", sub.key.SignId, "reason=", reason, "age=", time.Since(sub.startedAt).Round(time.Second))
+	if OnStop != nil {
+		info := sub.info()
+		go OnStop(info, reason)
+	}
+}
+
+// ObserveSigns 由轮询调用：openId 的 active_signs 中已经没有某个二维码签到时，说明这个账号已签到或签到已结束。
+// 只把该账号移出订阅；同一分组的其他账号可能还要扫同一个二维码，没有账号再看到该签到时才结束订阅。
+func ObserveSigns(openId string, signs []model.SignData) {
+	active := map[Key]bool{}
+	for _, s := range signs {
+		active[Key{CourseId: s.CourseID, SignId: s.SignID}] = true
+	}
+
+	subMu.Lock()
+	defer subMu.Unlock()
+	for key, sub := range subscriptions {
+		since, held := sub.holders[openId]
+		if !held || active[key] {
+			continue
+		}
+		// 只认登记之后的轮询结果，避免和登记那一轮的请求竞争
+		if time.Since(since) < 2*time.Second {
+			continue
+		}
+		delete(sub.holders, openId)
+		sub.audit.add(AuditRelease, openId)
+		if OnRelease != nil {
+			go OnRelease(key, openId)
+		}
+		if len(sub.holders) == 0 {
+			stopLocked(sub, StopSignClosed)
+		}
+	}
+}
+
+func watchdog() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		maxLifetime := time.Duration(viper.GetInt("qr.max_lifetime_minutes")) * time.Minute
+		grace := time.Duration(viper.GetInt("qr.viewer_grace_seconds")) * time.Second
+
+		subMu.Lock()
+		for _, sub := range subscriptions {
+			if maxLifetime > 0 && time.Since(sub.startedAt) > maxLifetime {
+				stopLocked(sub, StopLifetime)
+				continue
+			}
+			if len(sub.holders) > 0 || sub.viewers > 0 {
+				continue
+			}
+			if sub.idleSince.IsZero() {
+				sub.idleSince = time.Now()
+			} else if time.Since(sub.idleSince) > grace {
+				stopLocked(sub, StopNoViewers)
+			}
+		}
+		subMu.Unlock()
+	}
+}
+
+func (sub *subscription) info() SubscriptionInfo {
+	info := SubscriptionInfo{
+		Key:       sub.key,
+		Device:    sub.device,
+		Transport: sub.transport,
+		AuditID:   sub.audit.id,
+		StartedAt: sub.startedAt,
+		Accounts:  make([]string, 0, len(sub.holders)),
+		Viewers:   sub.viewers,
+	}
+	for openId := range sub.holders {
+		info.Accounts = append(info.Accounts, openId)
+	}
+	sort.Strings(info.Accounts)
+	return info
+}
+
+// List 返回当前全部订阅，按启动时间排序
+func List() []SubscriptionInfo {
+	subMu.Lock()
+	defer subMu.Unlock()
+	out := make([]SubscriptionInfo, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		out = append(out, sub.info())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
+
+// Status 按 signId 查找当前订阅
+func Status(signId int) (SubscriptionInfo, bool) {
+	for _, info := range List() {
+		if info.SignId == signId {
+			return info, true
+		}
+	}
+	return SubscriptionInfo{}, false
+}
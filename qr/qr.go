@@ -1,65 +1,113 @@
-﻿package qr
+package qr
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net"
 	"strings"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
 
+	"wzj_signin/bayeux"
 	"wzj_signin/db"
+	"wzj_signin/device"
 	"wzj_signin/model"
 )
 
 var wsUrl string = "wss://www.teachermate.com.cn/faye"
+var pollUrl string = "https://www.teachermate.com.cn/faye"
 
-func InitQrSign(courseId int, signId int) {
-	// 启动一个独立 WS 连接监听二维码更新
-	go Start(courseId, signId)
+// InitQrSign 为账号登记一个二维码签到订阅：同一 (courseId, signId) 只会有一个 WS 连接
+func InitQrSign(courseId int, signId int, openId string, profile device.Profile) {
+	ensure(Key{CourseId: courseId, SignId: signId}, openId, false, profile)
 }
 
-func extractQrUrlFromMessage(msg []byte) string {
-	qrCodeUrl := ""
-	var qrArr []model.QRCodeUrlData
-	if err := json.Unmarshal(msg, &qrArr); err == nil {
-		for _, it := range qrArr {
-			if strings.TrimSpace(it.Data.QrURL) != "" {
-				qrCodeUrl = strings.TrimSpace(it.Data.QrURL)
-				break
-			}
+// 二维码推送的 data 字段：{"type":1,"qrUrl":"..."}
+func extractQrUrl(m bayeux.Message) string {
+	var data model.Data
+	if err := json.Unmarshal(m.Data, &data); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(data.QrURL)
+}
+
+// transports 按 qr.transports 配置的顺序生成传输；websocket 被拦截时依次降级到 HTTP 轮询
+func transports(profile device.Profile) []func() bayeux.Transport {
+	var out []func() bayeux.Transport
+	for _, name := range viper.GetStringSlice("qr.transports") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "websocket":
+			out = append(out, func() bayeux.Transport {
+				return bayeux.NewWebSocketTransport(wsUrl, profile.Header())
+			})
+		case "long-polling":
+			out = append(out, func() bayeux.Transport {
+				return bayeux.NewLongPollingTransport(pollUrl, profile.Header())
+			})
+		case "callback-polling":
+			out = append(out, func() bayeux.Transport {
+				return bayeux.NewCallbackPollingTransport(pollUrl, profile.Header())
+			})
+		default:
+			log.Println("Unknown qr transport:", name)
 		}
 	}
-	if qrCodeUrl != "" {
-		return qrCodeUrl
+	if len(out) == 0 {
+		out = append(out, func() bayeux.Transport {
+			return bayeux.NewWebSocketTransport(wsUrl, profile.Header())
+		})
 	}
+	return out
+}
 
-	var single model.QRCodeUrlData
-	if err := json.Unmarshal(msg, &single); err == nil {
-		return strings.TrimSpace(single.Data.QrURL)
-	}
-	return ""
+// Hooks 是 Start 的回调，均可为 nil
+type Hooks struct {
+	// Transport 在每次握手成功（含降级、重连）时收到当前传输名称
+	Transport func(name string)
+	// Event 收到 bayeux 客户端事件，以及每次二维码轮换（AuditRotation，detail 为二维码链接）
+	Event func(event string, detail string)
 }
 
-func receiveHandler(connection *websocket.Conn, done chan struct{}, signId int) {
-	defer close(done)
-	loggedOnce := false
-	for {
-		_, msg, err := connection.ReadMessage()
-		if err != nil {
-			if ne, ok := err.(net.Error); ok && ne.Timeout() {
-				// 如果外部误设置了 read deadline，超时不应导致整个监听退出
-				continue
+// Start 建立 Faye 连接并持续接收二维码，直到 stop 被关闭。
+// 连接断开时按服务端 advice 自动重连并重新订阅；只有服务端明确不允许重连时才提前返回。
+func Start(courseId int, signId int, profile device.Profile, stop <-chan struct{}, hooks Hooks) {
+	log.Println("QR WS start:", "courseId=", courseId, "signId=", signId, "device=", profile.Name)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			log.Println("QR WS stop:", "courseId=", courseId, "signId=", signId)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	client := bayeux.NewClient(transports(profile)...)
+	client.OnEvent = func(event string, detail string) {
+		log.Println("QR WS", event+":", "signId=", signId, detail)
+		if hooks.Event != nil {
+			if event == bayeux.EventHandshake {
+				detail = client.Transport() + " " + detail
 			}
-			log.Println("Error in receive:", err)
-			return
+			hooks.Event(event, detail)
+		}
+		if event == bayeux.EventHandshake && hooks.Transport != nil {
+			hooks.Transport(client.Transport())
 		}
+	}
 
-		qrCodeUrl := extractQrUrlFromMessage(msg)
+	loggedOnce := false
+	lastUrl := ""
+	channel := fmt.Sprintf("/attendance/%d/%d/qr", courseId, signId)
+	_ = client.Subscribe(ctx, channel, func(m bayeux.Message) {
+		qrCodeUrl := extractQrUrl(m)
 		if qrCodeUrl == "" {
-			continue
+			return
 		}
 		if !loggedOnce {
 			log.Println("QR url received:", signId, qrCodeUrl)
@@ -70,100 +118,17 @@ func receiveHandler(connection *websocket.Conn, done chan struct{}, signId int)
 		result := db.RedisSet("wzj:qr:"+fmt.Sprint(signId), qrCodeUrl, 15*time.Minute)
 		if result.Err() != nil {
 			log.Println("Error setting key:", result.Err())
-			return
-		}
-	}
-}
-
-func Start(courseId int, signId int) {
-	done := make(chan struct{})
-	log.Println("QR WS start:", "courseId=", courseId, "signId=", signId)
-
-	conn, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
-	if err != nil {
-		log.Println("Error connecting to Websocket Server:", err)
-		return
-	}
-	defer func() {
-		_ = conn.Close()
-	}()
-
-	// 1) handshake
-	handshake := `[{"channel":"/meta/handshake","version":"1.0","supportedConnectionTypes":["websocket"],"id":"1"}]`
-	if err := conn.WriteMessage(websocket.TextMessage, []byte(handshake)); err != nil {
-		log.Println("Error during handshake write:", err)
-		return
-	}
-
-	clientID, err := waitForClientID(conn, 6*time.Second)
-	if err != nil {
-		log.Println("Handshake failed:", err)
-		return
-	}
-	log.Println("QR WS handshake ok:", "clientId=", clientID, "signId=", signId)
-	// waitForClientID 会设置 ReadDeadline；握手成功后要清除，否则后续 ReadMessage 会很快 i/o timeout
-	_ = conn.SetReadDeadline(time.Time{})
-
-	// 2) subscribe
-	subscribe := fmt.Sprintf(`[{"channel":"/meta/subscribe","clientId":"%s","subscription":"/attendance/%d/%d/qr","id":"2"}]`, clientID, courseId, signId)
-	if err := conn.WriteMessage(websocket.TextMessage, []byte(subscribe)); err != nil {
-		log.Println("Error during subscribe write:", err)
-		return
-	}
-	log.Println("QR WS subscribed:", "/attendance/", courseId, "/", signId, "/qr")
-	// 不强依赖 subscribe ack（有的环境下 ack 会延迟），先启动接收
-	go receiveHandler(conn, done, signId)
-
-	// 3) connect loop（提高频率，降低首码/轮换延迟）
-	var counter = 3
-	connectTicker := time.NewTicker(1 * time.Second)
-	defer connectTicker.Stop()
-
-	for {
-		select {
-		case <-connectTicker.C:
-			counter = counter + 1
-			connectString := fmt.Sprintf(`[{"channel":"/meta/connect","clientId":"%s","connectionType":"websocket","id":"%d"}]`, clientID, counter)
-			if err := conn.WriteMessage(websocket.TextMessage, []byte(connectString)); err != nil {
-				log.Println("Error during writing to websocket:", err)
-				return
-			}
-		case <-done:
-			return
 		}
-	}
-}
-
-func waitForClientID(conn *websocket.Conn, timeout time.Duration) (string, error) {
-	deadline := time.Now().Add(timeout)
-	for time.Now().Before(deadline) {
-		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
-		_, msg, err := conn.ReadMessage()
-		if err != nil {
-			// 读超时继续等
-			if websocket.IsUnexpectedCloseError(err) {
-				return "", err
+		if qrCodeUrl != lastUrl {
+			lastUrl = qrCodeUrl
+			if hooks.Event != nil {
+				hooks.Event(AuditRotation, qrCodeUrl)
 			}
-			continue
 		}
+		publish(signId, qrCodeUrl)
+	})
 
-		// handshake 响应通常是数组
-		var arr []model.WSData
-		if err := json.Unmarshal(msg, &arr); err == nil {
-			for _, it := range arr {
-				if it.Channel == "/meta/handshake" && it.Successful && strings.TrimSpace(it.ClientID) != "" {
-					return strings.TrimSpace(it.ClientID), nil
-				}
-			}
-			continue
-		}
-
-		var single model.WSData
-		if err := json.Unmarshal(msg, &single); err == nil {
-			if single.Channel == "/meta/handshake" && single.Successful && strings.TrimSpace(single.ClientID) != "" {
-				return strings.TrimSpace(single.ClientID), nil
-			}
-		}
+	if err := client.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		log.Println("QR WS exit:", "signId=", signId, err)
 	}
-	return "", fmt.Errorf("timeout waiting for clientId")
 }
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"wzj_signin/config"
+	"wzj_signin/notify"
+)
+
+// maskedValue 替换接口返回中的凭据，提交时原样带回表示保持不变
+const maskedValue = "******"
+
+// maskTarget 把渠道地址中的凭据替换为 maskedValue：企业微信的 key、钉钉的 access_token 在查询参数里，
+// 飞书的 token 是 webhook 路径的最后一段
+func maskTarget(ch config.NotifyChannel) string {
+	u, err := url.Parse(ch.Target)
+	if err != nil {
+		return ch.Target
+	}
+	param := ""
+	switch ch.Type {
+	case "wecom":
+		param = "key"
+	case "dingtalk":
+		param = "access_token"
+	case "feishu":
+		i := strings.LastIndex(u.Path, "/")
+		if i < 0 || i == len(u.Path)-1 {
+			return ch.Target
+		}
+		return u.Scheme + "://" + u.Host + u.Path[:i+1] + maskedValue
+	default:
+		return ch.Target
+	}
+	parts := strings.Split(u.RawQuery, "&")
+	for i, part := range parts {
+		if k, _, ok := strings.Cut(part, "="); ok && k == param {
+			parts[i] = k + "=" + maskedValue
+		}
+	}
+	u.RawQuery = strings.Join(parts, "&")
+	return u.String()
+}
+
+// maskSecrets 去掉渠道密钥（签名密钥、机器人加签密钥等），并遮住地址和 options 中的凭据，接口只写不读
+func maskSecrets(s config.AccountSettings) config.AccountSettings {
+	channels := make([]config.NotifyChannel, len(s.Channels))
+	for i, ch := range s.Channels {
+		ch.Secret = ""
+		ch.Target = maskTarget(ch)
+		if ch.Options["auth"] != "" {
+			opts := make(map[string]string, len(ch.Options))
+			for k, v := range ch.Options {
+				opts[k] = v
+			}
+			opts["auth"] = maskedValue
+			ch.Options = opts
+		}
+		channels[i] = ch
+	}
+	s.Channels = channels
+	return s
+}
+
+// keepSecrets 让提交中密钥为空、凭据仍为 maskedValue 的渠道沿用已保存的值（GET 返回的总是遮住的）
+func keepSecrets(payload *config.AccountSettings, stored config.AccountSettings) {
+	for i, ch := range payload.Channels {
+		id := strings.TrimSpace(ch.ID)
+		typ := strings.ToLower(strings.TrimSpace(ch.Type))
+		target := strings.TrimSpace(ch.Target)
+		for _, old := range stored.Channels {
+			if id != "" && old.ID != id {
+				continue
+			}
+			if id == "" && (old.Type != typ || (old.Target != target && maskTarget(old) != target)) {
+				continue
+			}
+			if ch.Secret == "" {
+				payload.Channels[i].Secret = old.Secret
+			}
+			if strings.Contains(target, maskedValue) && maskTarget(old) == target {
+				payload.Channels[i].Target = old.Target
+			}
+			if ch.Options["auth"] == maskedValue {
+				payload.Channels[i].Options["auth"] = old.Options["auth"]
+			}
+			break
+		}
+	}
+}
+
+// GET /api/accounts/settings?email=...（不带 email 返回全部），渠道密钥不会返回
+func GetAccountSettingsHandler(c *gin.Context) {
+	if email := strings.TrimSpace(c.Query("email")); email != "" {
+		s, err := config.GetAccountSettings(email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, maskSecrets(s))
+		return
+	}
+	all, err := config.ListAccountSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range all {
+		all[i] = maskSecrets(all[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"accounts": all})
+}
+
+// POST /api/accounts/settings，渠道的 secret 留空表示保持不变
+func UpdateAccountSettingsHandler(c *gin.Context) {
+	var payload config.AccountSettings
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误：" + err.Error()})
+		return
+	}
+	if !strings.Contains(payload.Email, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写有效的邮箱"})
+		return
+	}
+	esc := payload.Escalation
+	if esc.ResendAfterMinutes < 0 || esc.MaxResends < 0 || esc.SecondaryAfterMinutes < 0 || esc.BuddyAfterMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "分钟数与次数不能为负数"})
+		return
+	}
+	if esc.SecondaryEmail != "" && !strings.Contains(esc.SecondaryEmail, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "备用邮箱格式错误"})
+		return
+	}
+
+	if err := notify.ValidateQuietHours(payload.QuietHours); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "免打扰时段设置错误：" + err.Error()})
+		return
+	}
+
+	stored, err := config.GetAccountSettings(payload.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	keepSecrets(&payload, stored)
+	for _, ch := range payload.Channels {
+		if strings.Contains(ch.Target, maskedValue) || ch.Options["auth"] == maskedValue {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "通知渠道 " + ch.Type + " 的凭据已隐藏，修改地址时请填写完整的地址"})
+			return
+		}
+	}
+
+	for _, ch := range payload.Channels {
+		if ch.Type == "email" && strings.TrimSpace(ch.Target) == "" {
+			ch.Target = payload.Email
+		}
+		if err := notify.Validate(ch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "通知渠道 " + ch.Type + " 配置错误：" + err.Error()})
+			return
+		}
+	}
+
+	s, err := config.UpdateAccountSettings(payload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, maskSecrets(s))
+}
+
+// GET /api/notify/kinds：可用的通知渠道类型与事件类型
+func NotifyKindsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"kinds":         notify.Kinds(),
+		"events":        notify.AllEvents,
+		"defaultEvents": notify.DefaultEvents,
+	})
+}
+
+// GET /api/admin/webhooks/deadletter?limit=50
+func WebhookDeadLettersHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	items, err := notify.DeadLetters(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "count": len(items)})
+}
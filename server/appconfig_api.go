@@ -1,23 +1,66 @@
 package server
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"wzj_signin/config"
+	"wzj_signin/mail"
 )
 
+type mailConfigPayload struct {
+	Enabled  bool   `json:"enabled"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+
+	Security           string `json:"security"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	Helo               string `json:"helo"`
+	Auth               string `json:"auth"`
+}
+
+func (p mailConfigPayload) toConfig() config.MailConfig {
+	return config.MailConfig{
+		Enabled:            p.Enabled,
+		Host:               strings.TrimSpace(p.Host),
+		Port:               p.Port,
+		Username:           strings.TrimSpace(p.Username),
+		Password:           p.Password,
+		From:               strings.TrimSpace(p.From),
+		Security:           strings.ToLower(strings.TrimSpace(p.Security)),
+		InsecureSkipVerify: p.InsecureSkipVerify,
+		Helo:               strings.TrimSpace(p.Helo),
+		Auth:               strings.ToLower(strings.TrimSpace(p.Auth)),
+	}
+}
+
+// validateMailConfig 返回给用户看的错误信息，合法时为空
+func validateMailConfig(m config.MailConfig) string {
+	if m.Port < 0 || m.Port > 65535 {
+		return "邮件端口范围不合法（0-65535）"
+	}
+	switch m.Security {
+	case "", "ssl", "starttls", "none":
+	default:
+		return "加密方式只能是 ssl / starttls / none（留空为自动）"
+	}
+	switch m.Auth {
+	case "", "plain", "login", "cram-md5", "none":
+	default:
+		return "认证方式只能是 plain / login / cram-md5 / none（留空为自动）"
+	}
+	return ""
+}
+
 type appConfigUpdatePayload struct {
-	NormalDelay int `json:"normal_delay"`
-	Mail        struct {
-		Enabled  bool   `json:"enabled"`
-		Host     string `json:"host"`
-		Port     int    `json:"port"`
-		Username string `json:"username"`
-		Password string `json:"password"`
-		From     string `json:"from"`
-	} `json:"mail"`
+	NormalDelay int               `json:"normal_delay"`
+	Mail        mailConfigPayload `json:"mail"`
 }
 
 func GetAppConfigHandler(c *gin.Context) {
@@ -38,14 +81,7 @@ func UpdateAppConfigHandler(c *gin.Context) {
 
 	updated := config.AppConfig{
 		NormalDelay: payload.NormalDelay,
-		Mail: config.MailConfig{
-			Enabled:  payload.Mail.Enabled,
-			Host:     payload.Mail.Host,
-			Port:     payload.Mail.Port,
-			Username: payload.Mail.Username,
-			Password: payload.Mail.Password,
-			From:     payload.Mail.From,
-		},
+		Mail:        payload.Mail.toConfig(),
 	}
 
 	// Minimal validation (avoid obviously wrong values)
@@ -53,8 +89,8 @@ func UpdateAppConfigHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "延迟时间范围不合法（0-600 秒）"})
 		return
 	}
-	if updated.Mail.Port < 0 || updated.Mail.Port > 65535 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "邮件端口范围不合法（0-65535）"})
+	if msg := validateMailConfig(updated.Mail); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 		return
 	}
 
@@ -65,3 +101,50 @@ func UpdateAppConfigHandler(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, cfg)
 }
+
+// POST /api/appconfig/test-email {"to":"...","mail":{...}}
+// 立即发送一封测试邮件（不经过队列，也不要求启用邮件提醒）。带 mail 时使用表单中尚未保存的配置，
+// 其中密码留空表示使用已保存的密码（仅当服务器与用户名未改动时）；失败时返回出错的 SMTP 步骤与响应码。
+func TestEmailHandler(c *gin.Context) {
+	var payload struct {
+		To   string             `json:"to"`
+		Mail *mailConfigPayload `json:"mail"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误：" + err.Error()})
+		return
+	}
+	to := strings.TrimSpace(payload.To)
+	if !strings.Contains(to, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写收件邮箱"})
+		return
+	}
+
+	saved := mail.Settings()
+	cfg := saved
+	if payload.Mail != nil {
+		cfg = payload.Mail.toConfig()
+		// 已保存的密码只用于同一服务器与用户名，避免被发往其它服务器
+		if cfg.Password == "" && strings.EqualFold(cfg.Host, saved.Host) && cfg.Username == saved.Username {
+			cfg.Password = saved.Password
+		}
+	}
+	if msg := validateMailConfig(cfg); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := mail.Test(cfg, to); err != nil {
+		resp := gin.H{"error": err.Error()}
+		var smtpErr *mail.SMTPError
+		if errors.As(err, &smtpErr) {
+			resp["stage"] = smtpErr.Stage
+			if code := smtpErr.Code(); code != 0 {
+				resp["code"] = code
+			}
+		}
+		c.JSON(http.StatusBadGateway, resp)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "测试邮件已发送到 " + to})
+}
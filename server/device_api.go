@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"wzj_signin/device"
+)
+
+type deviceAssignPayload struct {
+	OpenId string `json:"openId" binding:"required"`
+	Device string `json:"device"`
+}
+
+func GetDevicesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"profiles": device.List(), "default": device.Default().Name})
+}
+
+// AssignDeviceHandler 修改某个 OpenID 使用的设备档案，device 为空表示恢复默认
+func AssignDeviceHandler(c *gin.Context) {
+	var payload deviceAssignPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误：" + err.Error()})
+		return
+	}
+	name := strings.TrimSpace(payload.Device)
+	if name != "" {
+		if _, ok := device.Get(name); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未知的设备档案：" + name})
+			return
+		}
+	}
+	if err := device.Assign(strings.TrimSpace(payload.OpenId), name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"openId": payload.OpenId, "device": device.ForOpenId(payload.OpenId).Name})
+}
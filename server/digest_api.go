@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"wzj_signin/config"
+	"wzj_signin/notify"
+	"wzj_signin/service"
+)
+
+func digestPeriod(v string) (string, bool) {
+	switch v = strings.ToLower(strings.TrimSpace(v)); v {
+	case "", notify.DigestDaily:
+		return notify.DigestDaily, true
+	case notify.DigestWeekly:
+		return v, true
+	}
+	return "", false
+}
+
+// GET /api/digest/preview?email=...&period=daily|weekly：截至现在的汇总，不发送
+func DigestPreviewHandler(c *gin.Context) {
+	email := config.NormalizeEmail(c.Query("email"))
+	if !strings.Contains(email, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写有效的邮箱"})
+		return
+	}
+	period, ok := digestPeriod(c.Query("period"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period 只能是 daily 或 weekly"})
+		return
+	}
+	to := time.Now()
+	from, err := service.DigestStart(period, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	digests, err := service.BuildDigests(period, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	d, ok := digests[email]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该邮箱没有监控中的 OpenID"})
+		return
+	}
+	e := notify.Event{Type: notify.EventDigest, Time: to, Email: email, Digest: d}
+	c.JSON(http.StatusOK, gin.H{"digest": d, "title": e.Title(), "text": e.Text()})
+}
+
+// POST /api/admin/digest/send {"period":"daily","email":"..."}：立即发送截至现在的汇总，
+// 带 email 时只发给该账号（不检查订阅设置），否则发给全部订阅了该周期的账号
+func DigestSendHandler(c *gin.Context) {
+	var payload struct {
+		Period string `json:"period"`
+		Email  string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误：" + err.Error()})
+		return
+	}
+	period, ok := digestPeriod(payload.Period)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period 只能是 daily 或 weekly"})
+		return
+	}
+	sent, err := service.SendDigests(period, time.Now(), payload.Email)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrNoDigest) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "汇总已发送", "accounts": sent})
+}
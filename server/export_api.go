@@ -0,0 +1,57 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"wzj_signin/history"
+)
+
+// GET /api/history/export.csv（过滤参数同 /api/history）
+func ExportCSVHandler(c *gin.Context) {
+	f, err := parseHistoryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="wzj_history_`+time.Now().Format("20060102")+`.csv"`)
+	if err := history.WriteCSV(c.Writer, f); err != nil {
+		log.Println("Error exporting history csv:", err)
+	}
+}
+
+// GET /api/history/export.jsonl（过滤参数同 /api/history）
+func ExportJSONLHandler(c *gin.Context) {
+	f, err := parseHistoryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="wzj_history_`+time.Now().Format("20060102")+`.jsonl"`)
+	if err := history.WriteJSONL(c.Writer, f); err != nil {
+		log.Println("Error exporting history jsonl:", err)
+	}
+}
+
+// CalendarHandler 输出检测到的签到日历，可在日历应用中订阅：
+// GET /api/history/calendar.ics?openId=...（默认最近 90 天）
+func CalendarHandler(c *gin.Context) {
+	f, err := parseHistoryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if f.From.IsZero() {
+		f.From = time.Now().AddDate(0, 0, -90)
+	}
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Cache-Control", "no-cache")
+	if err := history.WriteICS(c.Writer, f, "微助教签到", 10*time.Minute); err != nil {
+		log.Println("Error exporting history ics:", err)
+	}
+}
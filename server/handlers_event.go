@@ -2,13 +2,17 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 
 	"wzj_signin/db"
+	"wzj_signin/history"
 )
 
 // PendingEventHandler returns one pending event (FIFO) for the given openId.
@@ -46,3 +50,94 @@ func PendingEventHandler(c *gin.Context) {
 	payload["ok"] = true
 	c.JSON(http.StatusOK, payload)
 }
+
+// EventStreamHandler 以 Server-Sent Events 推送签到检测、签到结果、二维码提醒和 OpenID 失效。
+// 与 /pendingevent 不同，推送不会消费事件：多个标签页/设备可以同时订阅。
+// GET /api/events/stream?openId=a&openId=b（不带 openId 表示全部账号）
+// 断线重连时浏览器会自动带上 Last-Event-ID；首次连接也可用 ?lastEventId= 指定补发起点。
+func EventStreamHandler(c *gin.Context) {
+	f := history.Filter{}
+	for _, v := range c.QueryArray("openId") {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				f.OpenIds = append(f.OpenIds, id)
+			}
+		}
+	}
+
+	lastID := strings.TrimSpace(c.GetHeader("Last-Event-ID"))
+	if lastID == "" {
+		lastID = strings.TrimSpace(c.Query("lastEventId"))
+	}
+	if lastID != "" && !history.ValidID(lastID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+		return
+	}
+
+	// 先订阅再补发，保证补发与实时推送之间不丢事件
+	live, cancel := history.Subscribe()
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(e history.Event) bool {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return true
+		}
+		if _, err := fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, b); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		lastID = e.ID
+		return true
+	}
+
+	// 重连间隔建议 3 秒
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	c.Writer.Flush()
+
+	if lastID != "" {
+		missed, err := history.Since(f, lastID, 1000)
+		if err != nil {
+			log.Println("Error replaying history events:", err)
+		}
+		for _, e := range missed {
+			if !send(e) {
+				return
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case e, ok := <-live:
+			if !ok {
+				// 订阅者过慢被踢出：结束响应，让浏览器带 Last-Event-ID 重连补发
+				return
+			}
+			if lastID != "" && history.CompareID(e.ID, lastID) <= 0 {
+				continue
+			}
+			if !f.Match(e) {
+				continue
+			}
+			if !send(e) {
+				return
+			}
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package server
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -11,7 +16,9 @@ import (
 	"github.com/go-redis/redis/v8"
 
 	"wzj_signin/db"
+	"wzj_signin/device"
 	"wzj_signin/qr"
+	"wzj_signin/service"
 )
 
 func PendingQRCodeHandler(c *gin.Context) {
@@ -62,15 +69,206 @@ func PendingQRCodeHandler(c *gin.Context) {
 
 func QRCodeHandler(c *gin.Context) {
 	signId := c.Param("signId")
+	// /qr/:signId.png 与 /qr/:signId.svg 共用同一个路由参数
+	if ext := path.Ext(signId); ext == ".png" || ext == ".svg" {
+		qrImage(c, strings.TrimSuffix(signId, ext), ext)
+		return
+	}
+	transport := ""
+	accounts := 0
+	members := []service.QRGroupAccount{}
+	if id, err := strconv.Atoi(signId); err == nil {
+		if info, ok := qr.Status(id); ok {
+			transport = info.Transport
+			accounts = len(info.Accounts)
+			members = service.QRGroupAccounts(info.CourseId, id)
+		}
+	}
+	qrUrl, err := db.RedisGet("wzj:qr:" + signId).Result()
+	if err != nil {
+		if err != redis.Nil {
+			log.Println("Error getting value for key:", err)
+		}
+		qrUrl = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"qrUrl": qrUrl, "transport": transport, "accounts": accounts, "members": members})
+}
+
+// qrImage 把当前二维码链接渲染成图片，可选参数：size（像素）、level（L/M/Q/H）、margin（模块数）。
+// ETag 由二维码链接和渲染参数决定，二维码轮换后 ETag 随之变化。
+func qrImage(c *gin.Context, signId string, ext string) {
 	qrUrl, err := db.RedisGet("wzj:qr:" + signId).Result()
 	if err != nil {
 		if err != redis.Nil {
 			log.Println("Error getting value for key:", err)
 		}
-		c.JSON(http.StatusOK, gin.H{"qrUrl": ""})
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusNotFound, gin.H{"error": "二维码尚未生成或已过期"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"qrUrl": qrUrl})
+
+	opt := qr.DefaultImageOptions()
+	if v := c.Query("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 64 || size > 2048 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size 范围为 64-2048"})
+			return
+		}
+		opt.Size = size
+	}
+	if v := c.Query("level"); v != "" {
+		level, ok := qr.ParseLevel(v)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "level 只能是 L / M / Q / H"})
+			return
+		}
+		opt.Level = level
+	}
+	if v := c.Query("margin"); v != "" {
+		margin, err := strconv.Atoi(v)
+		if err != nil || margin < 0 || margin > 16 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "margin 范围为 0-16"})
+			return
+		}
+		opt.Margin = margin
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d|%s|%d", qrUrl, ext, opt.Size, qr.LevelName(opt.Level), opt.Margin)))
+	etag := `"` + hex.EncodeToString(sum[:10]) + `"`
+	c.Header("ETag", etag)
+	// 二维码每隔几秒轮换，只允许带 ETag 的协商缓存
+	c.Header("Cache-Control", "no-cache")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	var body []byte
+	contentType := "image/png"
+	if ext == ".svg" {
+		body, err = qr.RenderSVG(qrUrl, opt)
+		contentType = "image/svg+xml"
+	} else {
+		body, err = qr.RenderPNG(qrUrl, opt)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// QRStreamHandler 以 SSE 推送二维码轮换：收到新二维码时立即下发，
+// intervalMs 为观察到的轮换间隔，供页面显示倒计时。签到订阅结束时发送 closed 事件。
+// GET /qr/:signId/stream
+func QRStreamHandler(c *gin.Context) {
+	signId, err := strconv.Atoi(strings.TrimSpace(c.Param("signId")))
+	if err != nil || signId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid signId"})
+		return
+	}
+
+	live, current, cancel := qr.Watch(signId)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(event string, v interface{}) bool {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return true
+		}
+		if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, b); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	fmt.Fprint(c.Writer, "retry: 2000\n\n")
+	c.Writer.Flush()
+
+	// 服务重启或订阅刚建立时内存里还没有记录，先用 Redis 缓存的二维码
+	if current.QrURL == "" {
+		if qrUrl, err := db.RedisGet("wzj:qr:" + strconv.Itoa(signId)).Result(); err == nil && qrUrl != "" {
+			current = qr.Rotation{SignId: signId, QrURL: qrUrl}
+		}
+	}
+	if current.QrURL != "" && !send("qr", current) {
+		return
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case r, ok := <-live:
+			if !ok {
+				send("closed", gin.H{"signId": signId})
+				return
+			}
+			if !send("qr", r) {
+				return
+			}
+		}
+	}
+}
+
+// QRConfirmHandler 用户在二维码页确认某个账号已扫码：记录完成事件、设置冷却，分组内账号全部完成后结束二维码订阅。
+// 共享二维码页用 account（GET /qr/:signId 返回的 ref）指明账号；都不带时只在仅剩一个未完成账号时生效。
+// POST /qr/:signId/confirm?courseId=...&openId=...|account=...
+func QRConfirmHandler(c *gin.Context) {
+	signId, _ := strconv.Atoi(strings.TrimSpace(c.Param("signId")))
+	courseId, _ := strconv.Atoi(strings.TrimSpace(c.Query("courseId")))
+	if signId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "invalid signId"})
+		return
+	}
+
+	if info, ok := qr.Status(signId); ok && courseId <= 0 {
+		courseId = info.CourseId
+	}
+	if courseId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "invalid courseId"})
+		return
+	}
+
+	openId := strings.TrimSpace(c.Query("openId"))
+	if ref := strings.TrimSpace(c.Query("account")); openId == "" && ref != "" {
+		id, ok := service.QRGroupOpenId(courseId, signId, ref)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "该签到中没有这个账号"})
+			return
+		}
+		openId = id
+	}
+	if openId == "" {
+		var pending []string
+		for _, a := range service.QRGroupAccounts(courseId, signId) {
+			if !a.Done {
+				pending = append(pending, a.Ref)
+			}
+		}
+		if len(pending) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "请选择已扫码的账号"})
+			return
+		}
+		openId, _ = service.QRGroupOpenId(courseId, signId, pending[0])
+	}
+
+	completed := service.CompleteQRSign(courseId, signId, []string{openId}, service.CompletedConfirmed)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "completed": completed, "remaining": service.QRGroupRemaining(courseId, signId)})
 }
 
 // 允许二维码页在打开时主动触发一次 WS 监听（用于服务重启后、或用户较晚打开页面时）
@@ -86,6 +284,65 @@ func StartQRCodeWSHandler(c *gin.Context) {
 		return
 	}
 
-	go qr.InitQrSign(courseId, signId)
+	qr.AddViewer(courseId, signId, device.Default())
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// 二维码页关闭时（pagehide + sendBeacon）减少观看计数
+// POST /qrws/stop?courseId=1449049&signId=3854920
+func StopQRCodeWSHandler(c *gin.Context) {
+	courseId, _ := strconv.Atoi(strings.TrimSpace(c.Query("courseId")))
+	signId, _ := strconv.Atoi(strings.TrimSpace(c.Query("signId")))
+	if courseId <= 0 || signId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "message": "invalid courseId/signId"})
+		return
+	}
+	qr.RemoveViewer(courseId, signId)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// GET /api/admin/qr/subscriptions
+func QRSubscriptionsHandler(c *gin.Context) {
+	subs := qr.List()
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subs, "count": len(subs)})
+}
+
+// GET /api/admin/qr/audits?limit=20
+func QRAuditsHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 200 {
+		limit = 20
+	}
+	audits, err := qr.Audits(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"audits": audits, "count": len(audits)})
+}
+
+// GET /api/admin/qr/audits/:id
+func QRAuditHandler(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+	entries, err := qr.Audit(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "audit not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "entries": entries})
+}
+
+// POST /api/admin/qr/subscriptions/stop?courseId=...&signId=...
+func StopQRSubscriptionHandler(c *gin.Context) {
+	courseId, _ := strconv.Atoi(strings.TrimSpace(c.Query("courseId")))
+	signId, _ := strconv.Atoi(strings.TrimSpace(c.Query("signId")))
+	if !qr.Stop(courseId, signId, qr.StopAdmin) {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "message": "subscription not found"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
@@ -1,10 +1,10 @@
 package server
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -21,30 +21,16 @@ func RegisterOpenIDHandler(c *gin.Context) {
 		return
 	}
 
-	openId := registerOpenIdData.OpenId
-	value := registerOpenIdData.Value
-	location := registerOpenIdData.Location
-
-	// OpenID 设定 4 小时过期
-	result := db.RedisSet("wzj:user:"+openId, value, 4*time.Hour)
-	if result.Err() != nil {
-		log.Println("Error setting wzj:user key:", result.Err())
+	valid, err := service.RegisterOpenId(registerOpenIdData)
+	if errors.Is(err, service.ErrUnknownDevice) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未知的设备档案：" + registerOpenIdData.Device})
 		return
 	}
-
-	// 保存用户自定义经纬度（0 表示永不过期）
-	if location != "" {
-		err := db.RedisSet("wzj:gps:"+openId, location, 0).Err()
-		if err != nil {
-			log.Println("Error setting wzj:gps key:", err)
-		} else {
-			log.Println("Location saved for", openId, ":", location)
-		}
-	}
-
-	// 验证 OpenID 并返回结果
-	_, err := service.GetAllSigns(openId)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !valid {
 		c.JSON(http.StatusOK, gin.H{"message": "你提供的OpenId无效，请重新检查。"})
 		return
 	}
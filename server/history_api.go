@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"wzj_signin/history"
+)
+
+// parseHistoryFilter 从查询参数构造过滤条件。
+// openId 可重复出现或用逗号分隔；from/to 支持 RFC3339、2006-01-02 或 Unix 秒。
+func parseHistoryFilter(c *gin.Context) (history.Filter, error) {
+	var f history.Filter
+	for _, v := range c.QueryArray("openId") {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				f.OpenIds = append(f.OpenIds, id)
+			}
+		}
+	}
+	f.CourseId, _ = strconv.Atoi(c.Query("courseId"))
+	f.SignId, _ = strconv.Atoi(c.Query("signId"))
+	f.Type = strings.TrimSpace(c.Query("type"))
+	f.Mode = strings.TrimSpace(c.Query("mode"))
+	f.Result = strings.TrimSpace(c.Query("result"))
+
+	var err error
+	if f.From, err = history.ParseTime(c.Query("from")); err != nil {
+		return f, err
+	}
+	if f.To, err = history.ParseEndTime(c.Query("to")); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// GET /api/history?openId=...&courseId=...&type=attempt&result=failed&from=2024-03-01&limit=50&cursor=...
+func HistoryHandler(c *gin.Context) {
+	f, err := parseHistoryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	events, next, err := history.Query(f, c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events, "count": len(events), "nextCursor": next})
+}
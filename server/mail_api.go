@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"wzj_signin/mail"
+)
+
+// GET /api/admin/mail/queue：发送队列概况
+func MailQueueHandler(c *gin.Context) {
+	stats, err := mail.Stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GET /api/admin/mail/failed?limit=50：重试耗尽的邮件，新的在前
+func MailFailedHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	items, err := mail.FailedJobs(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "count": len(items)})
+}
+
+// POST /api/admin/mail/failed/retry {"id":"..."}：重新放入发送队列
+func MailRetryHandler(c *gin.Context) {
+	var payload struct {
+		ID string `json:"id"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil || strings.TrimSpace(payload.ID) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 id"})
+		return
+	}
+	if err := mail.RetryFailed(strings.TrimSpace(payload.ID)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, mail.ErrJobNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已重新加入发送队列"})
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"wzj_signin/config"
+	"wzj_signin/notify"
+)
+
+// channelPreference 是偏好矩阵中的一行：渠道与它实际订阅的事件（停用的渠道为空）
+type channelPreference struct {
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Target  string   `json:"target,omitempty"`
+	Enabled bool     `json:"enabled"`
+	Events  []string `json:"events"`
+}
+
+// GET /api/accounts/preferences?email=...：各渠道订阅的事件与免打扰设置
+func GetPreferencesHandler(c *gin.Context) {
+	email := config.NormalizeEmail(c.Query("email"))
+	if !strings.Contains(email, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写有效的邮箱"})
+		return
+	}
+	s, err := config.GetAccountSettings(email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	channels := s.Channels
+	if len(channels) == 0 {
+		channels = []config.NotifyChannel{{ID: "email", Type: "email", Enabled: true}}
+	}
+	rows := make([]channelPreference, 0, len(channels))
+	for _, ch := range channels {
+		row := channelPreference{ID: ch.ID, Type: ch.Type, Target: ch.Target, Enabled: ch.Enabled, Events: []string{}}
+		if ch.Type == "email" && row.Target == "" {
+			row.Target = email
+		}
+		if ch.Enabled {
+			row.Events = notify.EffectiveEvents(ch)
+		}
+		rows = append(rows, row)
+	}
+	held, _ := notify.HeldCount(email)
+	c.JSON(http.StatusOK, gin.H{
+		"email":      email,
+		"events":     notify.AllEvents,
+		"channels":   rows,
+		"quietHours": s.QuietHours,
+		"held":       held,
+	})
+}
+
+// POST /api/accounts/preferences {"email":"...","channels":{"<渠道 id>":["signed",...]},"quietHours":{...}}
+// 只修改提交了的渠道；事件为空表示停用该渠道。账号之前没有配置渠道时，先补上默认的邮件渠道。
+func UpdatePreferencesHandler(c *gin.Context) {
+	var payload struct {
+		Email      string              `json:"email"`
+		Channels   map[string][]string `json:"channels"`
+		QuietHours config.QuietHours   `json:"quietHours"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误：" + err.Error()})
+		return
+	}
+	if !strings.Contains(payload.Email, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写有效的邮箱"})
+		return
+	}
+	if err := notify.ValidateQuietHours(payload.QuietHours); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "免打扰时段设置错误：" + err.Error()})
+		return
+	}
+
+	s, err := config.GetAccountSettings(payload.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(s.Channels) == 0 {
+		s.Channels = append(s.Channels, config.NotifyChannel{ID: "email", Type: "email", Enabled: true})
+	}
+	for id := range payload.Channels {
+		found := false
+		for _, ch := range s.Channels {
+			found = found || ch.ID == id
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "没有这个通知渠道：" + id})
+			return
+		}
+	}
+	for i, ch := range s.Channels {
+		events, ok := payload.Channels[ch.ID]
+		if !ok {
+			continue
+		}
+		ch.Events = nil
+		ch.Enabled = len(events) > 0
+		if ch.Enabled {
+			ch.Events = events
+		}
+		check := ch
+		if check.Type == "email" && strings.TrimSpace(check.Target) == "" {
+			check.Target = s.Email
+		}
+		if err := notify.Validate(check); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "通知渠道 " + ch.ID + " 配置错误：" + err.Error()})
+			return
+		}
+		s.Channels[i] = ch
+	}
+	s.QuietHours = payload.QuietHours
+
+	if _, err := config.UpdateAccountSettings(s); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "通知偏好已保存"})
+}
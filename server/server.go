@@ -33,6 +33,13 @@ func Start() {
 	r.GET("/settings", func(c *gin.Context) { c.File("./static/settings.html") })
 	r.GET("/settings/", func(c *gin.Context) { c.Redirect(http.StatusMovedPermanently, "/settings") })
 
+	// Service Worker 的作用域不能超出脚本所在路径，需要从根路径提供
+	r.GET("/sw.js", func(c *gin.Context) {
+		c.Header("Service-Worker-Allowed", "/")
+		c.Header("Cache-Control", "no-cache")
+		c.File("./static/sw.js")
+	})
+
 	// 3) 静态资源（CSS/JS/qr.html 等）
 	// 注意：Gin 不允许同时存在 /home 与 /home/*filepath，因此静态资源放到 /static
 	r.Static("/static", "./static") // 使用相对路径
@@ -41,13 +48,43 @@ func Start() {
 	r.POST("/register", RegisterOpenIDHandler)
 	r.GET("/openids", OpenIdsHandler)
 	r.GET("/qr/:signId", QRCodeHandler)
+	r.GET("/qr/:signId/stream", QRStreamHandler)
+	r.POST("/qr/:signId/confirm", QRConfirmHandler)
 	r.GET("/qrws/start", StartQRCodeWSHandler)
+	r.POST("/qrws/stop", StopQRCodeWSHandler)
+	r.GET("/api/admin/qr/subscriptions", QRSubscriptionsHandler)
+	r.POST("/api/admin/qr/subscriptions/stop", StopQRSubscriptionHandler)
+	r.GET("/api/admin/qr/audits", QRAuditsHandler)
+	r.GET("/api/admin/qr/audits/:id", QRAuditHandler)
 	r.GET("/pendingqr/:openId", PendingQRCodeHandler)
 	r.GET("/pendingevent/:openId", PendingEventHandler)
+	r.GET("/api/events/stream", EventStreamHandler)
 	r.GET("/api/appconfig", GetAppConfigHandler)
 	r.POST("/api/appconfig", UpdateAppConfigHandler)
+	r.POST("/api/appconfig/test-email", TestEmailHandler)
 	r.GET("/api/frontendsettings", GetFrontendSettingsHandler)
 	r.POST("/api/frontendsettings", UpdateFrontendSettingsHandler)
+	r.GET("/api/accounts/settings", GetAccountSettingsHandler)
+	r.POST("/api/accounts/settings", UpdateAccountSettingsHandler)
+	r.GET("/api/accounts/preferences", GetPreferencesHandler)
+	r.POST("/api/accounts/preferences", UpdatePreferencesHandler)
+	r.GET("/api/notify/kinds", NotifyKindsHandler)
+	r.GET("/api/admin/webhooks/deadletter", WebhookDeadLettersHandler)
+	r.GET("/api/admin/mail/queue", MailQueueHandler)
+	r.GET("/api/admin/mail/failed", MailFailedHandler)
+	r.POST("/api/admin/mail/failed/retry", MailRetryHandler)
+	r.GET("/api/digest/preview", DigestPreviewHandler)
+	r.POST("/api/admin/digest/send", DigestSendHandler)
+	r.GET("/api/webpush/key", WebPushKeyHandler)
+	r.POST("/api/webpush/subscribe", WebPushSubscribeHandler)
+	r.POST("/api/webpush/unsubscribe", WebPushUnsubscribeHandler)
+	r.GET("/api/devices", GetDevicesHandler)
+	r.GET("/api/history", HistoryHandler)
+	r.GET("/api/history/export.csv", ExportCSVHandler)
+	r.GET("/api/history/export.jsonl", ExportJSONLHandler)
+	r.GET("/api/history/calendar.ics", CalendarHandler)
+	r.GET("/api/stats", StatsHandler)
+	r.POST("/api/devices/assign", AssignDeviceHandler)
 	r.GET("/serverinfo", ServerInfoHandler)
 	r.GET("/notice", ServerNoticeHandler)
 
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"wzj_signin/history"
+)
+
+// 预设时间范围：today / 7d / 30d / 90d / all；from、to 会覆盖预设
+func applyStatsRange(f *history.Filter, rng string) bool {
+	now := time.Now()
+	switch rng {
+	case "today":
+		y, m, d := now.Date()
+		f.From = time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	case "7d":
+		f.From = now.AddDate(0, 0, -7)
+	case "", "30d":
+		f.From = now.AddDate(0, 0, -30)
+	case "90d":
+		f.From = now.AddDate(0, 0, -90)
+	case "all":
+	default:
+		return false
+	}
+	return true
+}
+
+// GET /api/stats?openId=...&courseId=...&range=7d
+func StatsHandler(c *gin.Context) {
+	f, err := parseHistoryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 统计口径由 Summarize 决定，不允许按事件类型/结果过滤
+	f.Type, f.Result = "", ""
+
+	if f.From.IsZero() {
+		to := f.To
+		if !applyStatsRange(&f, c.Query("range")) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "range 只能是 today / 7d / 30d / 90d / all"})
+			return
+		}
+		f.To = to
+	}
+
+	report, err := history.Summarize(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": f.From, "to": f.To, "total": report.Total, "accounts": report.Accounts, "courses": report.Courses})
+}
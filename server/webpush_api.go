@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"wzj_signin/config"
+	"wzj_signin/notify"
+	"wzj_signin/webpush"
+)
+
+// GET /api/webpush/key：前端订阅时使用的 VAPID 公钥
+func WebPushKeyHandler(c *gin.Context) {
+	keys, err := config.GetVAPIDKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"publicKey": keys.PublicKey})
+}
+
+type webPushSubscribeRequest struct {
+	Email        string               `json:"email"`
+	Subscription webpush.Subscription `json:"subscription"`
+	Events       []string             `json:"events"`
+}
+
+// POST /api/webpush/subscribe：把浏览器订阅保存为账号的 webpush 通知渠道，同一订阅地址重复提交会覆盖
+func WebPushSubscribeHandler(c *gin.Context) {
+	var payload webPushSubscribeRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误：" + err.Error()})
+		return
+	}
+	if !strings.Contains(payload.Email, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写有效的邮箱"})
+		return
+	}
+	sub := payload.Subscription
+	ch := config.NotifyChannel{
+		Type:    "webpush",
+		Enabled: true,
+		Events:  payload.Events,
+		Target:  strings.TrimSpace(sub.Endpoint),
+		Options: map[string]string{"p256dh": sub.Keys.P256dh, "auth": sub.Keys.Auth},
+	}
+	if err := notify.Validate(ch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "推送订阅无效：" + err.Error()})
+		return
+	}
+
+	s, err := config.GetAccountSettings(payload.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 账号之前没有配置渠道时默认发邮件，添加推送后保留邮件渠道
+	if len(s.Channels) == 0 {
+		s.Channels = append(s.Channels, config.NotifyChannel{Type: "email", Enabled: true})
+	}
+	replaced := false
+	for i, old := range s.Channels {
+		if old.Type == "webpush" && old.Target == ch.Target {
+			ch.ID = old.ID
+			if ch.Events == nil {
+				ch.Events = old.Events
+			}
+			s.Channels[i] = ch
+			replaced = true
+		}
+	}
+	if !replaced {
+		sum := sha256.Sum256([]byte(ch.Target))
+		ch.ID = "webpush-" + hex.EncodeToString(sum[:4])
+		s.Channels = append(s.Channels, ch)
+	}
+	if _, err := config.UpdateAccountSettings(s); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已开启浏览器推送", "id": ch.ID})
+}
+
+// POST /api/webpush/unsubscribe {"email":"...","endpoint":"..."}
+func WebPushUnsubscribeHandler(c *gin.Context) {
+	var payload struct {
+		Email    string `json:"email"`
+		Endpoint string `json:"endpoint"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式错误：" + err.Error()})
+		return
+	}
+	if !strings.Contains(payload.Email, "@") || strings.TrimSpace(payload.Endpoint) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少邮箱或订阅地址"})
+		return
+	}
+	if err := notify.RemoveWebPush(payload.Email, strings.TrimSpace(payload.Endpoint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已关闭浏览器推送"})
+}
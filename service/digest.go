@@ -0,0 +1,343 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 静态编译的镜像里不一定有时区数据
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/config"
+	"wzj_signin/db"
+	"wzj_signin/history"
+	"wzj_signin/notify"
+)
+
+// 日报 / 周报：每天 digest.time（digest.timezone 时区）汇总各账号过去 24 小时的签到，
+// 每周 digest.weekly_day 的同一时间汇总过去 7 天。数据来自服务端签到历史，
+// 每个周期用 Redis 标记只发送一次，重启或多实例运行时不会重复发送；
+// 当天错过发送时间（如服务在此期间重启）会在启动后补发。
+
+// ErrNoDigest 表示指定的邮箱既没有监控中的 OpenID，也没有失效记录
+var ErrNoDigest = errors.New("no monitored account for this email")
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// StartDigest 在 digest.enabled 时每分钟检查一次是否到了发送时间
+func StartDigest() {
+	if !viper.GetBool("digest.enabled") {
+		return
+	}
+	log.Println("Digest scheduler started:", viper.GetString("digest.time"), viper.GetString("digest.timezone"))
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		runDueDigests(time.Now())
+		<-ticker.C
+	}
+}
+
+func digestLocation() *time.Location {
+	name := strings.TrimSpace(viper.GetString("digest.timezone"))
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Println("Invalid digest.timezone, using local time:", err)
+		return time.Local
+	}
+	return loc
+}
+
+// digestClock 解析 digest.time（HH:MM），格式错误时用 21:00
+func digestClock() (int, int) {
+	t, err := time.Parse("15:04", strings.TrimSpace(viper.GetString("digest.time")))
+	if err != nil {
+		log.Println("Invalid digest.time, using 21:00:", err)
+		return 21, 0
+	}
+	return t.Hour(), t.Minute()
+}
+
+// digestWeekday 解析 digest.weekly_day，支持英文星期名与 0-6（0 为周日）
+func digestWeekday() time.Weekday {
+	v := strings.ToLower(strings.TrimSpace(viper.GetString("digest.weekly_day")))
+	if d, ok := weekdays[v]; ok {
+		return d
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 && n <= 6 {
+		return time.Weekday(n)
+	}
+	log.Println("Invalid digest.weekly_day, using sunday:", v)
+	return time.Sunday
+}
+
+func runDueDigests(now time.Time) {
+	loc := digestLocation()
+	now = now.In(loc)
+	hour, minute := digestClock()
+	at := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, loc)
+	if now.Before(at) {
+		return
+	}
+	periods := []string{notify.DigestDaily}
+	if at.Weekday() == digestWeekday() {
+		periods = append(periods, notify.DigestWeekly)
+	}
+	for _, period := range periods {
+		key := fmt.Sprintf("wzj:digest:sent:%s:%s", period, at.Format("2006-01-02"))
+		ok, err := db.RedisSetNX(key, now.Unix(), 8*24*time.Hour).Result()
+		if err != nil {
+			log.Println("Error claiming digest run:", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		sent, err := SendDigests(period, at, "")
+		if err != nil {
+			log.Println("Error sending digests:", period, err)
+			continue
+		}
+		log.Println("Digest sent:", period, at.Format("2006-01-02"), "accounts=", sent)
+	}
+}
+
+// DigestStart 返回截至 to 的日报 / 周报起点
+func DigestStart(period string, to time.Time) (time.Time, error) {
+	switch period {
+	case notify.DigestDaily:
+		return to.AddDate(0, 0, -1), nil
+	case notify.DigestWeekly:
+		return to.AddDate(0, 0, -7), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown digest period %q", period)
+}
+
+// wantsDigest 判断账号是否订阅了该周期的汇总，账号未设置时按 digest.daily / digest.weekly
+func wantsDigest(email string, period string) bool {
+	s, err := config.GetAccountSettings(email)
+	if err != nil {
+		log.Println("Error reading account settings:", err)
+	}
+	if s.Digest == nil {
+		return viper.GetBool("digest." + period)
+	}
+	if period == notify.DigestWeekly {
+		return s.Digest.Weekly
+	}
+	return s.Digest.Daily
+}
+
+// SendDigests 生成截至 to 的汇总并分发，返回发出的账号数。only 不为空时只发给该账号且不检查订阅设置。
+func SendDigests(period string, to time.Time, only string) (int, error) {
+	from, err := DigestStart(period, to)
+	if err != nil {
+		return 0, err
+	}
+	digests, err := BuildDigests(period, from, to)
+	if err != nil {
+		return 0, err
+	}
+	only = config.NormalizeEmail(only)
+	if only != "" {
+		d, ok := digests[only]
+		if !ok {
+			return 0, ErrNoDigest
+		}
+		notify.Dispatch(notify.Event{Type: notify.EventDigest, Time: to, Email: only, Digest: d})
+		return 1, nil
+	}
+
+	sent := 0
+	for email, d := range digests {
+		if !wantsDigest(email, period) {
+			continue
+		}
+		if d.Empty() && viper.GetBool("digest.skip_empty") {
+			continue
+		}
+		notify.Dispatch(notify.Event{Type: notify.EventDigest, Time: to, Email: email, Digest: d})
+		sent++
+	}
+	return sent, nil
+}
+
+// digestSign 汇总同一 (openId, signId) 的全部历史事件
+type digestSign struct {
+	openId    string
+	email     string // 事件记录时绑定的邮箱
+	sign      notify.DigestSign
+	seen      bool // 期间内发现或提交过，只有完成记录的签到属于上一个周期
+	succeeded bool
+	failed    bool
+	completed bool
+}
+
+// BuildDigests 按账号汇总 [from, to) 内的签到历史。签到按历史事件中记录的邮箱归属，
+// OpenID 失效或 4 小时后自然过期都不影响。结果包含监控池中的全部账号（没有签到时为空汇总），
+// 以及期间有签到或失效记录的账号；期间出现过、现已不在监控池中的 OpenID 计入失效列表。
+func BuildDigests(period string, from, to time.Time) (map[string]*notify.Digest, error) {
+	live := map[string]string{} // 监控池中的 openId -> 邮箱
+	for _, k := range db.RedisGetAllMatchedKeys("wzj:user:*") {
+		openId := strings.TrimPrefix(k, "wzj:user:")
+		if v, err := db.RedisGet(k).Result(); err == nil && openId != "" && strings.TrimSpace(v) != "" {
+			live[openId] = config.NormalizeEmail(v)
+		}
+	}
+	recorded := map[string]string{} // 历史事件中记录的 openId -> 邮箱，以最后一条为准
+	var seenIds []string
+
+	type signKey struct {
+		openId string
+		signId int
+	}
+	signs := map[signKey]*digestSign{}
+	var order []signKey
+	var expired []history.Event
+
+	f := history.Filter{From: from, To: to.Add(-time.Millisecond)}
+	err := history.Range(f, func(e history.Event) error {
+		if e.OpenId != "" {
+			if _, ok := recorded[e.OpenId]; !ok {
+				seenIds = append(seenIds, e.OpenId)
+				recorded[e.OpenId] = ""
+			}
+			if e.Email != "" {
+				recorded[e.OpenId] = config.NormalizeEmail(e.Email)
+			}
+		}
+		if e.Type == history.TypeExpired {
+			expired = append(expired, e)
+			return nil
+		}
+		k := signKey{e.OpenId, e.SignId}
+		s := signs[k]
+		if s == nil {
+			s = &digestSign{openId: e.OpenId}
+			signs[k] = s
+			order = append(order, k)
+		}
+		if s.email == "" && e.Email != "" {
+			s.email = config.NormalizeEmail(e.Email)
+		}
+		if s.sign.Time.IsZero() && e.Type != history.TypeCompleted {
+			s.sign.Time = e.Time.In(to.Location())
+		}
+		if e.CourseName != "" {
+			s.sign.CourseName = e.CourseName
+		}
+		if e.Mode != "" {
+			s.sign.Mode = e.Mode
+		}
+		switch e.Type {
+		case history.TypeDetected:
+			s.seen = true
+		case history.TypeAttempt:
+			s.seen = true
+			if e.Result == history.ResultSuccess {
+				s.succeeded = true
+				if e.StudentRank > 0 {
+					s.sign.StudentRank = e.StudentRank
+				}
+			} else {
+				s.failed = true
+				s.sign.Reason = e.Reason
+			}
+		case history.TypeCompleted:
+			s.completed = s.completed || e.Result == history.ResultSuccess
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 历史事件没有记录邮箱时（旧数据）才按监控池归属
+	ownerOf := func(openId, email string) string {
+		if email != "" {
+			return email
+		}
+		if email = recorded[openId]; email != "" {
+			return email
+		}
+		return live[openId]
+	}
+
+	out := map[string]*notify.Digest{}
+	digestOf := func(email string) *notify.Digest {
+		d := out[email]
+		if d == nil {
+			d = &notify.Digest{Period: period, From: from, To: to}
+			out[email] = d
+		}
+		return d
+	}
+	for _, email := range live {
+		digestOf(email)
+	}
+	// 失效记录只在签到接口报错时写入，按 TTL 自然过期的 OpenID 没有记录，
+	// 期间出现过但已不在监控池中的也算作失效
+	reported := map[string]bool{}
+	for _, e := range expired {
+		if email := ownerOf(e.OpenId, config.NormalizeEmail(e.Email)); email != "" && !reported[e.OpenId] {
+			reported[e.OpenId] = true
+			d := digestOf(email)
+			d.Expired = append(d.Expired, e.OpenId)
+		}
+	}
+	for _, openId := range seenIds {
+		if _, ok := live[openId]; ok || reported[openId] {
+			continue
+		}
+		if email := ownerOf(openId, ""); email != "" {
+			reported[openId] = true
+			d := digestOf(email)
+			d.Expired = append(d.Expired, openId)
+		}
+	}
+	for _, k := range order {
+		s := signs[k]
+		email := ownerOf(s.openId, s.email)
+		if !s.seen || email == "" {
+			continue
+		}
+		d := digestOf(email)
+		d.Detected++
+		switch {
+		case s.sign.Mode == "qr":
+			d.QRDetected++
+			s.sign.Status = notify.DigestQRDone
+			if !s.completed && !s.succeeded {
+				d.QRMissed++
+				s.sign.Status = notify.DigestQRMissed
+			}
+		case s.succeeded:
+			d.AutoSigned++
+			s.sign.Status = notify.DigestSigned
+		case s.failed:
+			d.Failed++
+			s.sign.Status = notify.DigestFailed
+		default:
+			s.sign.Status = notify.DigestPending
+		}
+		if s.succeeded {
+			s.sign.Reason = ""
+		}
+		d.Signs = append(d.Signs, s.sign)
+	}
+	for _, d := range out {
+		sort.SliceStable(d.Signs, func(i, j int) bool { return d.Signs[i].Time.Before(d.Signs[j].Time) })
+	}
+	return out, nil
+}
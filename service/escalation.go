@@ -0,0 +1,262 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wzj_signin/config"
+	"wzj_signin/db"
+	"wzj_signin/history"
+	"wzj_signin/notify"
+	"wzj_signin/qr"
+)
+
+// 二维码签到无人响应时的升级提醒：按账号设置重发、通知备用邮箱、请同课程的同学帮忙。
+// 每个 (courseId, signId) 分组只有一个升级流程，由合并提醒的发起方启动，分组内每个邮箱按自己的设置执行；
+// 邮箱的账号都确认完成后跳过其余步骤，整个分组完成或二维码订阅结束时停止。
+var (
+	escalationMu sync.Mutex
+	escalations  = map[string]chan struct{}{}
+)
+
+type escalationStep struct {
+	id    string // 邮箱 + 步骤序号，分组成员变化后重新计算时用来跳过已执行的步骤
+	email string
+	after time.Duration
+	run   func()
+}
+
+func escalationKey(courseId int, signId int) string {
+	return fmt.Sprintf("%d:%d", courseId, signId)
+}
+
+// escalationSteps 按分组当前的成员与各邮箱的设置生成全部步骤，按时间排序
+func escalationSteps(courseId int, signId int, courseName string) []escalationStep {
+	emails, events, byEmail := qrGroupEvents(courseId, signId, courseName)
+	var steps []escalationStep
+	for _, email := range emails {
+		settings, err := config.GetAccountSettings(email)
+		if err != nil {
+			log.Println("Error reading account settings:", err)
+			continue
+		}
+		esc := settings.Escalation
+		if !esc.Enabled {
+			continue
+		}
+		base := events[email]
+		openIds := byEmail[email]
+
+		if esc.ResendAfterMinutes > 0 {
+			for i := 1; i <= esc.MaxResends; i++ {
+				n := i
+				steps = append(steps, escalationStep{
+					id:    fmt.Sprintf("%s#resend%d", email, n),
+					email: email,
+					after: time.Duration(esc.ResendAfterMinutes*n) * time.Minute,
+					run: func() {
+						// 重发时顺带延长前端的待处理提示
+						for _, openId := range openIds {
+							_ = db.RedisSet("wzj:qr:pending:"+openId, fmt.Sprintf("%d,%d", courseId, signId), 10*time.Minute).Err()
+						}
+						e := base
+						e.Reminder = n
+						notify.Dispatch(e)
+					},
+				})
+			}
+		}
+		if esc.SecondaryAfterMinutes > 0 && esc.SecondaryEmail != "" {
+			secondary := esc.SecondaryEmail
+			steps = append(steps, escalationStep{
+				id:    email + "#secondary",
+				email: email,
+				after: time.Duration(esc.SecondaryAfterMinutes) * time.Minute,
+				run: func() {
+					e := base
+					e.Secondary = true
+					notify.Send(config.NotifyChannel{ID: "secondary", Type: "email", Enabled: true, Target: secondary}, e)
+				},
+			})
+		}
+		if esc.BuddyAfterMinutes > 0 && len(esc.Buddies) > 0 {
+			buddies := esc.Buddies
+			steps = append(steps, escalationStep{
+				id:    email + "#buddies",
+				email: email,
+				after: time.Duration(esc.BuddyAfterMinutes) * time.Minute,
+				run:   func() { notifyBuddies(base, buddies) },
+			})
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].after < steps[j].after })
+	return steps
+}
+
+// startEscalation 在分组的首次二维码提醒发出后调用。之后加入分组的账号在下一步之前并入，
+// 步骤时间都从首次提醒算起。
+func startEscalation(courseId int, signId int, courseName string) {
+	if len(escalationSteps(courseId, signId, courseName)) == 0 {
+		return
+	}
+
+	key := escalationKey(courseId, signId)
+	escalationMu.Lock()
+	if _, running := escalations[key]; running {
+		escalationMu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	escalations[key] = stop
+	escalationMu.Unlock()
+
+	go func() {
+		defer func() {
+			escalationMu.Lock()
+			if escalations[key] == stop {
+				delete(escalations, key)
+			}
+			escalationMu.Unlock()
+		}()
+
+		start := time.Now()
+		fired := map[string]bool{}
+		for {
+			var step *escalationStep
+			steps := escalationSteps(courseId, signId, courseName)
+			for i := range steps {
+				if !fired[steps[i].id] {
+					step = &steps[i]
+					break
+				}
+			}
+			if step == nil {
+				return
+			}
+			timer := time.NewTimer(time.Until(start.Add(step.after)))
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if !qrGroupPending(courseId, signId) {
+				log.Println("QR escalation ended:", courseId, signId)
+				return
+			}
+			// 时间到了之后重新取一次步骤，等待期间成员与设置可能变化
+			fired[step.id] = true
+			if !qrEmailPending(step.email, courseId, signId) {
+				continue
+			}
+			log.Println("QR escalation step:", step.id, signId, "after", step.after)
+			step.run()
+		}
+	}()
+}
+
+// stopEscalation 在分组的账号都完成时调用
+func stopEscalation(courseId int, signId int) {
+	escalationMu.Lock()
+	defer escalationMu.Unlock()
+	key := escalationKey(courseId, signId)
+	if stop, ok := escalations[key]; ok {
+		close(stop)
+		delete(escalations, key)
+	}
+}
+
+// 仍需提醒：分组内还有账号没有确认完成，且二维码订阅还在（签到未结束）
+func qrGroupPending(courseId int, signId int) bool {
+	info, ok := qr.Status(signId)
+	if !ok || info.CourseId != courseId {
+		return false
+	}
+	for _, openId := range QRGroupMembers(courseId, signId) {
+		if !QRSignDone(openId, signId) {
+			return true
+		}
+	}
+	return false
+}
+
+// qrEmailPending 判断该邮箱在分组内是否还有没完成的账号
+func qrEmailPending(email string, courseId int, signId int) bool {
+	for _, openId := range QRGroupMembers(courseId, signId) {
+		if config.NormalizeEmail(FindEmailByOpenId(openId)) == email && !QRSignDone(openId, signId) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyBuddies 只通知当前确实能看到这个签到的同学（其监控中的 OpenID 轮询结果包含同一课程），
+// 通过同学自己的通知渠道发送
+func notifyBuddies(base notify.Event, buddies []string) {
+	for _, buddy := range buddies {
+		if !inCourse(buddy, base.CourseId, base.SignId) {
+			log.Println("QR escalation: buddy not in course, skipped:", buddy, base.CourseId)
+			continue
+		}
+		e := base
+		e.Email = buddy
+		e.OpenId = ""
+		e.OnBehalfOf = base.Email
+		notify.Dispatch(e)
+	}
+}
+
+// 最近一轮轮询看到签到的课程（逗号分隔），由 GetAllSigns 写入
+const lastSignsTTL = 10 * time.Minute
+
+func lastSignsKey(openId string) string {
+	return "wzj:signs:last:" + openId
+}
+
+// inCourse 只看已有的结果，不替同学发起轮询（轮询会触发签到等副作用）：
+// 同学的 OpenID 发现过这个签到，或最近一轮轮询里有该课程的签到
+func inCourse(email string, courseId int, signId int) bool {
+	openIds := OpenIdsByEmail(email)
+	if len(openIds) == 0 {
+		return false
+	}
+	for _, openId := range openIds {
+		v, err := db.RedisGet(lastSignsKey(openId)).Result()
+		if err != nil {
+			continue
+		}
+		for _, id := range strings.Split(v, ",") {
+			if id == strconv.Itoa(courseId) {
+				return true
+			}
+		}
+	}
+	events, _, err := history.Query(history.Filter{OpenIds: openIds, CourseId: courseId, SignId: signId, Type: history.TypeDetected}, "", 1)
+	if err != nil {
+		log.Println("Error reading history:", err)
+		return false
+	}
+	return len(events) > 0
+}
+
+// OpenIdsByEmail 返回监控池中绑定到该邮箱的 OpenID
+func OpenIdsByEmail(email string) []string {
+	email = config.NormalizeEmail(email)
+	var out []string
+	for _, k := range db.RedisGetAllMatchedKeys("wzj:user:*") {
+		openId := strings.TrimPrefix(k, "wzj:user:")
+		if openId == "" {
+			continue
+		}
+		if v, err := db.RedisGet(k).Result(); err == nil && config.NormalizeEmail(v) == email {
+			out = append(out, openId)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"time"
+
+	"wzj_signin/config"
+	"wzj_signin/db"
+)
+
+// 暂停监控按账号（邮箱）生效：该邮箱下的 OpenID 仍留在监控池，但主循环不再轮询
+func pauseKey(email string) string {
+	return "wzj:pause:" + config.NormalizeEmail(email)
+}
+
+// Pause 暂停账号的监控，d 为 0 表示直到 Resume
+func Pause(email string, d time.Duration) error {
+	return db.RedisSet(pauseKey(email), time.Now().Unix(), d).Err()
+}
+
+func Resume(email string) {
+	_ = db.RedisDel(pauseKey(email)).Err()
+}
+
+// PausedUntil 返回暂停截止时间（无期限时为零值）
+func PausedUntil(email string) (time.Time, bool) {
+	if _, err := db.RedisGet(pauseKey(email)).Result(); err != nil {
+		return time.Time{}, false
+	}
+	if d, err := db.RedisTTL(pauseKey(email)).Result(); err == nil && d > 0 {
+		return time.Now().Add(d), true
+	}
+	return time.Time{}, true
+}
+
+// IsPaused 供主循环判断是否跳过该 OpenID
+func IsPaused(openId string) bool {
+	email := FindEmailByOpenId(openId)
+	if email == "" {
+		return false
+	}
+	_, paused := PausedUntil(email)
+	return paused
+}
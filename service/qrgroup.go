@@ -0,0 +1,198 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/config"
+	"wzj_signin/db"
+	"wzj_signin/notify"
+)
+
+// 同一课程的多个账号遇到同一个二维码签到时按 (courseId, signId) 分组：
+// 第一个账号发现后等待 qr.group_window_seconds 收集其余账号，再合并成一条提醒；
+// 之后才加入的账号，只给尚未收到提醒的邮箱补发。升级提醒（见 escalation.go）也按分组只运行一个。
+const qrGroupTTL = 30 * time.Minute
+
+func qrGroupKey(kind string, courseId int, signId int) string {
+	return fmt.Sprintf("wzj:qr:group:%s:%d:%d", kind, courseId, signId)
+}
+
+// QRGroupMembers 返回遇到该二维码签到的全部账号
+func QRGroupMembers(courseId int, signId int) []string {
+	members, err := db.RedisSMembers(qrGroupKey("accounts", courseId, signId)).Result()
+	if err != nil {
+		log.Println("Error reading QR group:", err)
+		return nil
+	}
+	sort.Strings(members)
+	return members
+}
+
+func notifyQRGroup(courseId int, signId int, courseName string, openId string) {
+	accountsKey := qrGroupKey("accounts", courseId, signId)
+	_ = db.RedisSAdd(accountsKey, openId).Err()
+	_ = db.RedisExpire(accountsKey, qrGroupTTL).Err()
+
+	lead, err := db.RedisSetNX(qrGroupKey("lead", courseId, signId), openId, qrGroupTTL).Result()
+	if err != nil {
+		log.Println("Error acquiring QR group lead:", err)
+		lead = true
+	}
+	if lead {
+		window := time.Duration(viper.GetInt("qr.group_window_seconds")) * time.Second
+		time.Sleep(window)
+		// 先标记已发送再读取成员：之后加入的账号一定能看到标记并自行补发，不会两边都漏掉
+		_ = db.RedisSet(qrGroupKey("sent", courseId, signId), 1, qrGroupTTL).Err()
+		sendQRGroupNotification(courseId, signId, courseName, "")
+		startEscalation(courseId, signId, courseName)
+		return
+	}
+
+	// 合并提醒已经发出：只补发给还没收到的邮箱
+	if _, err := db.RedisGet(qrGroupKey("sent", courseId, signId)).Result(); err == nil {
+		sendQRGroupNotification(courseId, signId, courseName, FindEmailByOpenId(openId))
+	}
+}
+
+// qrGroupEvents 按邮箱生成分组的二维码提醒，每个事件都列出全部账号，邮箱按字母排序
+func qrGroupEvents(courseId int, signId int, courseName string) ([]string, map[string]notify.Event, map[string][]string) {
+	members := QRGroupMembers(courseId, signId)
+	if len(members) == 0 {
+		return nil, nil, nil
+	}
+
+	byEmail := map[string][]string{}
+	var emails []string
+	for _, id := range members {
+		email := config.NormalizeEmail(FindEmailByOpenId(id))
+		if email == "" {
+			continue
+		}
+		if _, ok := byEmail[email]; !ok {
+			emails = append(emails, email)
+		}
+		byEmail[email] = append(byEmail[email], id)
+	}
+	sort.Strings(emails)
+
+	qrPage := effectiveServerAddress() + "/static/qr.html?sign=" + fmt.Sprint(signId) + "&course=" + fmt.Sprint(courseId) + "&v=" + fmt.Sprint(time.Now().Unix())
+	if len(members) == 1 {
+		qrPage += "&openid=" + url.QueryEscape(members[0])
+	}
+
+	var accounts []string
+	for _, email := range emails {
+		for _, id := range byEmail[email] {
+			accounts = append(accounts, fmt.Sprintf("%s（OpenID %s）", email, maskOpenId(id)))
+		}
+	}
+
+	events := map[string]notify.Event{}
+	for _, email := range emails {
+		events[email] = notify.Event{
+			Type:       notify.EventQRRequired,
+			Email:      email,
+			OpenId:     byEmail[email][0],
+			CourseId:   courseId,
+			SignId:     signId,
+			CourseName: courseName,
+			Mode:       "qr",
+			QrPage:     qrPage,
+			Accounts:   accounts,
+			Cover:      courseCover(courseId),
+		}
+	}
+	return emails, events, byEmail
+}
+
+// sendQRGroupNotification 给分组内每个邮箱发送一封列出全部账号的提醒；only 非空时只发给该邮箱
+func sendQRGroupNotification(courseId int, signId int, courseName string, only string) {
+	emails, events, _ := qrGroupEvents(courseId, signId, courseName)
+	notifiedKey := qrGroupKey("notified", courseId, signId)
+	for _, email := range emails {
+		if only != "" && email != config.NormalizeEmail(only) {
+			continue
+		}
+		// SAdd 返回 1 才是第一次通知该邮箱，发起方与后加入的账号同时补发时只有一方发送
+		added, err := db.RedisSAdd(notifiedKey, email).Result()
+		if err != nil {
+			log.Println("Error marking QR group notified:", err)
+		} else if added == 0 {
+			continue
+		}
+		_ = db.RedisExpire(notifiedKey, qrGroupTTL).Err()
+		notify.Dispatch(events[email])
+	}
+}
+
+// QRGroupAccount 是共享二维码页上的一个账号。页面任何人都能打开，不返回 OpenID 与完整邮箱，
+// 确认时用 Ref 指明账号
+type QRGroupAccount struct {
+	Ref   string `json:"ref"`
+	Label string `json:"label"`
+	Done  bool   `json:"done"`
+}
+
+func qrAccountRef(openId string) string {
+	sum := sha256.Sum256([]byte(openId))
+	return hex.EncodeToString(sum[:6])
+}
+
+// QRGroupAccounts 返回分组内的账号及是否已确认完成
+func QRGroupAccounts(courseId int, signId int) []QRGroupAccount {
+	members := QRGroupMembers(courseId, signId)
+	out := make([]QRGroupAccount, 0, len(members))
+	for _, id := range members {
+		out = append(out, QRGroupAccount{
+			Ref:   qrAccountRef(id),
+			Label: fmt.Sprintf("%s（OpenID %s）", maskEmail(FindEmailByOpenId(id)), maskOpenId(id)),
+			Done:  QRSignDone(id, signId),
+		})
+	}
+	return out
+}
+
+// QRGroupOpenId 按 Ref 找回分组内账号的 OpenID
+func QRGroupOpenId(courseId int, signId int, ref string) (string, bool) {
+	for _, id := range QRGroupMembers(courseId, signId) {
+		if qrAccountRef(id) == ref {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// QRGroupRemaining 返回分组内还没有确认完成的账号数
+func QRGroupRemaining(courseId int, signId int) int {
+	n := 0
+	for _, id := range QRGroupMembers(courseId, signId) {
+		if !QRSignDone(id, signId) {
+			n++
+		}
+	}
+	return n
+}
+
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+func maskOpenId(openId string) string {
+	if len(openId) <= 8 {
+		return openId
+	}
+	return openId[:4] + "…" + openId[len(openId)-4:]
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"wzj_signin/db"
+	"wzj_signin/history"
+	"wzj_signin/qr"
+)
+
+// 二维码签到完成的方式
+const (
+	CompletedConfirmed  = "confirmed"   // 用户在二维码页点击“我已扫码”
+	CompletedSignClosed = "sign_closed" // 轮询结果中已经没有这个签到
+)
+
+func init() {
+	// 订阅因签到从轮询结果中消失而结束时，结束该签到的提醒（没有确认过的记为错过）
+	qr.OnStop = func(info qr.SubscriptionInfo, reason string) {
+		if reason == qr.StopSignClosed {
+			CompleteQRSign(info.CourseId, info.SignId, info.Accounts, CompletedSignClosed)
+		}
+	}
+	// 账号看不到签到了：没确认过的记为错过，分组里其他账号不受影响
+	qr.OnRelease = func(key qr.Key, openId string) {
+		CompleteQRSign(key.CourseId, key.SignId, []string{openId}, CompletedSignClosed)
+	}
+}
+
+func qrDoneKey(openId string, signId int) string {
+	return fmt.Sprintf("wzj:qr:done:%d:%s", signId, openId)
+}
+
+// QRSignDone 判断账号的二维码签到是否已完成
+func QRSignDone(openId string, signId int) bool {
+	_, err := db.RedisGet(qrDoneKey(openId, signId)).Result()
+	return err == nil
+}
+
+// CompleteQRSign 把二维码签到标记为已完成：记录历史事件、设置重复签到冷却、清掉待处理提醒，
+// 分组内账号全部完成时结束该签到的二维码订阅。每个账号只记录一次，返回本次新完成的账号。
+func CompleteQRSign(courseId int, signId int, openIds []string, how string) []string {
+	completed := []string{}
+	for _, openId := range openIds {
+		ok, err := db.RedisSetNX(qrDoneKey(openId, signId), how, 24*time.Hour).Result()
+		if err != nil {
+			log.Println("Error marking QR sign done:", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		completed = append(completed, openId)
+
+		// 只有用户确认才算完成；签到直接从轮询结果中消失时无法知道是否扫过码，记为错过
+		result := history.ResultSuccess
+		if how != CompletedConfirmed {
+			result = history.ResultMissed
+		}
+		history.Record(history.Event{
+			Type:     history.TypeCompleted,
+			OpenId:   openId,
+			Email:    FindEmailByOpenId(openId),
+			CourseId: courseId,
+			SignId:   signId,
+			Mode:     "qr",
+			Result:   result,
+			Reason:   how,
+		})
+		CoolDownFor5Min(openId, signId)
+		_ = db.RedisDel("wzj:qr:pending:" + openId).Err()
+	}
+	if len(completed) > 0 {
+		log.Println("QR sign completed:", "courseId=", courseId, "signId=", signId, "how=", how, "accounts=", completed)
+	}
+
+	// 分组内其他账号可能还要扫同一个二维码，全部完成后才停止升级提醒和二维码订阅
+	if QRGroupRemaining(courseId, signId) == 0 {
+		stopEscalation(courseId, signId)
+		if how == CompletedConfirmed {
+			qr.Stop(courseId, signId, qr.StopConfirmed)
+		}
+	}
+	return completed
+}
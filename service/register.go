@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"wzj_signin/db"
+	"wzj_signin/device"
+	"wzj_signin/model"
+)
+
+// ErrUnknownDevice 表示登记时指定了不存在的设备档案
+var ErrUnknownDevice = errors.New("unknown device profile")
+
+// RegisterOpenId 把 OpenID 加入监控池（绑定通知邮箱、可选 GPS 与设备档案），
+// 然后立即轮询一次验证：返回 false 表示 OpenID 无效。供 /register 与 Telegram /add 共用。
+func RegisterOpenId(data model.RegisterOpenIdData) (bool, error) {
+	openId := data.OpenId
+	value := data.Value
+	location := data.Location
+	deviceName := strings.TrimSpace(data.Device)
+
+	if deviceName != "" {
+		if _, ok := device.Get(deviceName); !ok {
+			return false, ErrUnknownDevice
+		}
+	}
+
+	// OpenID 设定 4 小时过期
+	if err := db.RedisSet("wzj:user:"+openId, value, 4*time.Hour).Err(); err != nil {
+		log.Println("Error setting wzj:user key:", err)
+		return false, err
+	}
+
+	// 保存用户自定义经纬度（0 表示永不过期）
+	if location != "" {
+		err := db.RedisSet("wzj:gps:"+openId, location, 0).Err()
+		if err != nil {
+			log.Println("Error setting wzj:gps key:", err)
+		} else {
+			log.Println("Location saved for", openId, ":", location)
+		}
+	}
+
+	// 保存设备档案（与 GPS 一样永不过期，留空则沿用已有分配）
+	if deviceName != "" {
+		if err := device.Assign(openId, deviceName); err != nil {
+			log.Println("Error setting wzj:device key:", err)
+		}
+	}
+
+	// 验证 OpenID
+	if _, err := GetAllSigns(openId); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
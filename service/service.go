@@ -11,10 +11,13 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"wzj_signin/db"
-	"wzj_signin/mail"
+	"wzj_signin/device"
+	"wzj_signin/history"
 	"wzj_signin/model"
+	"wzj_signin/notify"
 	"wzj_signin/qr"
 
 	"github.com/spf13/viper"
@@ -45,9 +48,10 @@ func GetAllSigns(openId string) ([]model.SignData, error) {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36 Edg/122.0.0.0")
+	device.ForOpenId(openId).Apply(req.Header)
 	req.Header.Set("Openid", openId)
 	req.Header.Set("Host", "v18.teachermate.cn")
+	pollStart := time.Now()
 	response, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Println("Error sending GetAllSigns request:", err)
@@ -56,11 +60,15 @@ func GetAllSigns(openId string) ([]model.SignData, error) {
 	defer response.Body.Close()
 
 	body, _ := io.ReadAll(response.Body)
+	pollMs := time.Since(pollStart).Milliseconds()
 	log.Println(openId+":GetAllSigns Response:", string(body))
 	if string(body) == `{"message":"登录信息失效，请退出后重试"}` {
-		// 1s后过期
+		// 1s后过期，之后就查不到邮箱了，先取出来
+		email := FindEmailByOpenId(openId)
 		result := db.RedisExpire("wzj:user:"+openId, 1*time.Second)
 		log.Println(openId + ":Invalid OpenId!")
+		history.Record(history.Event{Type: history.TypeExpired, OpenId: openId, Email: email})
+		notify.Dispatch(notify.Event{Type: notify.EventExpired, Email: email, OpenId: openId})
 		if result.Err() != nil {
 			log.Println("Error setting key:", result.Err())
 			return nil, result.Err()
@@ -68,7 +76,20 @@ func GetAllSigns(openId string) ([]model.SignData, error) {
 		return nil, errors.New("无效OpenId")
 	}
 	var signList []model.SignData
-	json.Unmarshal(body, &signList)
+	if err := json.Unmarshal(body, &signList); err != nil {
+		// 网关错误页、限流提示等不是签到列表，不能当作“所有签到都已结束”交给二维码订阅
+		log.Println(openId+":Error parsing GetAllSigns response:", err)
+		return nil, err
+	}
+	courseIds := make([]string, 0, len(signList))
+	for i := range signList {
+		signList[i].DetectedAt = pollStart
+		signList[i].PollMs = pollMs
+		courseIds = append(courseIds, strconv.Itoa(signList[i].CourseID))
+	}
+	// 记下这一轮看到签到的课程，供升级提醒判断同学是否在课程里，不必再发请求
+	_ = db.RedisSet(lastSignsKey(openId), strings.Join(courseIds, ","), lastSignsTTL).Err()
+	qr.ObserveSigns(openId, signList)
 	return signList, nil
 }
 
@@ -111,6 +132,9 @@ func Signin(sign model.SignData, openId string) {
 	courseId := sign.CourseID
 	signId := sign.SignID
 	courseName := sign.Name
+	if sign.Cover != "" {
+		courseCovers.Store(courseId, sign.Cover)
+	}
 
 	// 1. 避免重复签到
 	openidSign := fmt.Sprintf("wzj:repeat:%s%d", openId, signId)
@@ -138,18 +162,46 @@ func Signin(sign model.SignData, openId string) {
 	}
 	defer db.RedisDel(inflightKey)
 
-	// 2. 二维码签到处理
-	if sign.IsQR != 0 {
-		serverAddress := effectiveServerAddress()
-		qrPage := serverAddress + "/static/qr.html?sign=" + fmt.Sprint(signId) + "&course=" + fmt.Sprint(courseId) + "&v=" + fmt.Sprint(time.Now().Unix())
-		mail_title := courseName + "正在二维码签到，需要手动完成"
-		mail_content := "立刻点击下方二维码网址（或复制到浏览器打开），使用微信扫一扫完成签到。\n签到完成后之前提交的OpenID可能会立刻失效，如果需要再次监控需要重新添加新的OpenID到监控池。\n二维码页面：" + qrPage
+	mode := signMode(sign)
+	email := FindEmailByOpenId(openId)
+	detectedAt := sign.DetectedAt
+	if detectedAt.IsZero() {
+		detectedAt = time.Now()
+	}
+	history.Record(history.Event{
+		Time:       detectedAt,
+		Type:       history.TypeDetected,
+		OpenId:     openId,
+		Email:      email,
+		CourseId:   courseId,
+		SignId:     signId,
+		CourseName: courseName,
+		Mode:       mode,
+		PollMs:     sign.PollMs,
+	})
+	// 失败后没有冷却，签到关闭前每个轮询周期都会再走到这里，每个签到只通知一次发现
+	if sign.IsQR == 0 && notifyOnce("detected", openId, signId, "") {
+		notify.Dispatch(notify.Event{
+			Type:       notify.EventDetected,
+			Time:       detectedAt,
+			Email:      email,
+			OpenId:     openId,
+			CourseId:   courseId,
+			SignId:     signId,
+			CourseName: courseName,
+			Mode:       mode,
+			Cover:      sign.Cover,
+		})
+	}
 
+	// 2. 二维码签到处理（已确认扫码的不再提醒）
+	if sign.IsQR != 0 && !QRSignDone(openId, signId) {
 		// 给前端一个可轮询的 pending 提示（方便弹窗/新标签页打开）
 		_ = db.RedisSet("wzj:qr:pending:"+openId, fmt.Sprintf("%d,%d", courseId, signId), 10*time.Minute).Err()
 
-		go qr.InitQrSign(courseId, signId)
-		mail.SendEmail(mail_title, mail_content, FindEmailByOpenId(openId))
+		qr.InitQrSign(courseId, signId, openId, device.ForOpenId(openId))
+		// 同课程的多个账号合并成一条提醒
+		go notifyQRGroup(courseId, signId, courseName, openId)
 		CoolDownFor5Min(openId, signId)
 	}
 
@@ -212,15 +264,32 @@ func Signin(sign model.SignData, openId string) {
 		requestBody = fmt.Sprintf(`{"courseId":%d,"signId":%d}`, courseId, signId)
 	}
 
+	attempt := history.Event{
+		Type:       history.TypeAttempt,
+		OpenId:     openId,
+		Email:      email,
+		CourseId:   courseId,
+		SignId:     signId,
+		CourseName: courseName,
+		Mode:       mode,
+	}
+	if sign.IsGPS == 1 {
+		attempt.Lat = lat
+		attempt.Lon = lon
+	}
+
 	// 创建请求
 	data := strings.NewReader(requestBody)
 	req, err := http.NewRequest("POST", signInUrl, data)
 	if err != nil {
 		log.Println(randomNum, "Error creating Signin request:", err)
+		attempt.Result, attempt.Reason, attempt.Message = history.ResultFailed, "request", err.Error()
+		history.Record(attempt)
+		notifyAttempt(attempt)
 		return
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36 Edg/122.0.0.0")
+	device.ForOpenId(openId).Apply(req.Header)
 	req.Header.Set("Openid", openId)
 	req.Header.Set("Host", "v18.teachermate.cn")
 	req.Header.Set("Content-Type", "application/json")
@@ -232,9 +301,15 @@ func Signin(sign model.SignData, openId string) {
 	}
 
 	// ================= 发送请求 =================
+	submittedAt := time.Now()
+	attempt.DelayMs = submittedAt.Sub(detectedAt).Milliseconds()
 	response, err := http.DefaultClient.Do(req)
+	attempt.ResponseMs = time.Since(submittedAt).Milliseconds()
 	if err != nil {
 		log.Println("Error sending Signin request:", err)
+		attempt.Result, attempt.Reason, attempt.Message = history.ResultFailed, "network", err.Error()
+		history.Record(attempt)
+		notifyAttempt(attempt)
 		return
 	}
 	defer response.Body.Close()
@@ -246,13 +321,23 @@ func Signin(sign model.SignData, openId string) {
 	// 成功判定：有时返回 JSON(studentRank)，有时返回文本(你已经签到成功)
 	success := strings.Contains(bodyStr, "你已经签到成功") || strings.Contains(bodyStr, "studentRank")
 
+	attempt.Result = history.ResultSuccess
+	if !success {
+		attempt.Result = history.ResultFailed
+		attempt.Reason = failureReason(response.StatusCode, bodyStr)
+		attempt.Message = truncate(bodyStr, 200)
+	}
+	if strings.Contains(bodyStr, "studentRank") {
+		var signResult model.SignResultData
+		_ = json.Unmarshal(body, &signResult)
+		attempt.SignRank = signResult.SignRank
+		attempt.StudentRank = signResult.StudentRank
+	}
+	history.Record(attempt)
+	notifyAttempt(attempt)
+
 	// Record successful sign-in event for history page
 	if success {
-		mode := "normal"
-		if sign.IsGPS == 1 {
-			mode = "gps"
-		}
-
 		evt := map[string]interface{}{
 			"type":       "signin",
 			"mode":       mode,
@@ -281,14 +366,94 @@ func Signin(sign model.SignData, openId string) {
 	if success {
 		CoolDownFor5Min(openId, signId)
 	}
+}
 
-	if strings.Contains(string(body), "studentRank") {
-		var signResult model.SignResultData
-		json.Unmarshal(body, &signResult)
-		mail_title := courseName + "刚刚签到！"
-		mail_content := fmt.Sprintf("【签到No.%d】你是第%d个签到的！该消息仅供参考，签到结果以实际为准。[%s/C%d/S%d/%s]", signResult.SignRank, signResult.StudentRank, courseName, courseId, signId, openId)
-		mail.SendEmail(mail_title, mail_content, FindEmailByOpenId(openId))
+// 课程封面只在签到列表中出现，记下来供之后的通知（升级提醒等）使用
+var courseCovers sync.Map
+
+func courseCover(courseId int) string {
+	if v, ok := courseCovers.Load(courseId); ok {
+		return v.(string)
+	}
+	return ""
+}
+
+// notifyAttempt 把签到结果发到账号的通知渠道
+func notifyAttempt(attempt history.Event) {
+	e := notify.Event{
+		Type:        notify.EventSigned,
+		Email:       attempt.Email,
+		OpenId:      attempt.OpenId,
+		CourseId:    attempt.CourseId,
+		SignId:      attempt.SignId,
+		CourseName:  attempt.CourseName,
+		Mode:        attempt.Mode,
+		SignRank:    attempt.SignRank,
+		StudentRank: attempt.StudentRank,
+		Cover:       courseCover(attempt.CourseId),
+	}
+	if attempt.Result != history.ResultSuccess {
+		e.Type = notify.EventFailed
+		e.Reason = attempt.Reason
+		e.Message = attempt.Message
+		// 失败会在每个轮询周期重试，同一原因只通知一次，原因变化时再通知
+		if !notifyOnce("failed", attempt.OpenId, attempt.SignId, attempt.Reason) {
+			return
+		}
+	} else if !notifyOnce("signed", attempt.OpenId, attempt.SignId, "") {
+		// 签到仍开放时，冷却结束后会再次提交并收到“你已经签到成功”，每个签到只通知一次成功
+		return
+	}
+	notify.Dispatch(e)
+}
+
+// notifyOnce 标记 (openId, signId) 的某类通知已发送，返回 true 表示第一次；Redis 出错时照常发送
+func notifyOnce(kind string, openId string, signId int, reason string) bool {
+	key := fmt.Sprintf("wzj:notified:%s:%s%d", kind, openId, signId)
+	if reason != "" {
+		key += ":" + reason
+	}
+	first, err := db.RedisSetNX(key, 1, 24*time.Hour).Result()
+	if err != nil {
+		log.Println("Error marking sign notified:", err)
+		return true
+	}
+	return first
+}
+
+// 签到方式：qr / gps / normal
+func signMode(sign model.SignData) string {
+	if sign.IsQR != 0 {
+		return "qr"
+	}
+	if sign.IsGPS == 1 {
+		return "gps"
+	}
+	return "normal"
+}
+
+// 把签到失败的响应归类，便于按原因统计
+func failureReason(status int, body string) string {
+	switch {
+	case strings.Contains(body, "登录信息失效"):
+		return "openid_expired"
+	case strings.Contains(body, "已结束") || strings.Contains(body, "不存在"):
+		return "closed"
+	case strings.Contains(body, "距离") || strings.Contains(body, "范围"):
+		return "location"
+	case status >= 500:
+		return "server_error"
+	default:
+		return "rejected"
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
 	}
+	return string(r[:n]) + "…"
 }
 
 func FindEmailByOpenId(openid string) string {
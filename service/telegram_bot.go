@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"wzj_signin/config"
+	"wzj_signin/db"
+	"wzj_signin/history"
+	"wzj_signin/mail"
+	"wzj_signin/model"
+	"wzj_signin/qr"
+	"wzj_signin/telegram"
+)
+
+const telegramHelp = `可用命令：
+/bind <邮箱> 向邮箱发送验证码，再发送 /bind <邮箱> <验证码> 把当前会话绑定到账号，之后的签到与二维码提醒会发到这里
+/status 查看监控中的 OpenID 与二维码签到
+/add <openid> 把 OpenID 加入监控池
+/pause [分钟] 暂停监控（不带分钟数表示直到 /resume）
+/resume 恢复监控
+/history [条数] 最近的签到记录`
+
+// StartTelegramBot 长轮询 getUpdates 处理命令，telegram 未启用时直接返回
+func StartTelegramBot() {
+	client, ok := telegram.FromConfig()
+	if !ok {
+		return
+	}
+	log.Println("Telegram bot started:", client.Base)
+
+	offset := 0
+	for {
+		timeout := viper.GetInt("telegram.poll_timeout")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout+30)*time.Second)
+		updates, err := client.GetUpdates(ctx, offset, timeout)
+		cancel()
+		if err != nil {
+			log.Println("Telegram getUpdates failed:", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message == nil || !strings.HasPrefix(u.Message.Text, "/") {
+				continue
+			}
+			chatID := strconv.FormatInt(u.Message.Chat.ID, 10)
+			reply := handleTelegramCommand(chatID, u.Message.Text)
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			if err := client.SendMessage(ctx, chatID, reply); err != nil {
+				log.Println("Telegram reply failed:", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func telegramChatAllowed(chatID string) bool {
+	allowed := viper.GetStringSlice("telegram.allowed_chats")
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, id := range allowed {
+		if strings.TrimSpace(id) == chatID {
+			return true
+		}
+	}
+	return false
+}
+
+func handleTelegramCommand(chatID string, text string) string {
+	if !telegramChatAllowed(chatID) {
+		return "这个会话没有使用权限（chat id: " + chatID + "）"
+	}
+	fields := strings.Fields(text)
+	// 群组里的命令形如 /status@botname
+	cmd := strings.SplitN(fields[0], "@", 2)[0]
+	args := fields[1:]
+
+	if cmd == "/start" || cmd == "/help" {
+		return telegramHelp + "\n\n当前 chat id: " + chatID
+	}
+	if cmd == "/bind" {
+		if len(args) == 0 || len(args) > 2 || !strings.Contains(args[0], "@") {
+			return "用法：/bind <邮箱>，收到验证码后发送 /bind <邮箱> <验证码>"
+		}
+		if len(args) == 2 {
+			return telegramConfirmBind(chatID, args[0], args[1])
+		}
+		return telegramRequestBind(chatID, args[0])
+	}
+
+	email := telegramEmail(chatID)
+	if email == "" {
+		return "当前会话还没有绑定账号，请先发送 /bind <邮箱>"
+	}
+
+	switch cmd {
+	case "/status":
+		return telegramStatus(email)
+	case "/add":
+		if len(args) != 1 {
+			return "用法：/add <openid>"
+		}
+		valid, err := RegisterOpenId(model.RegisterOpenIdData{OpenId: args[0], Value: email})
+		if err != nil {
+			return "添加失败：" + err.Error()
+		}
+		if !valid {
+			return "你提供的OpenId无效，请重新检查。"
+		}
+		return "OpenId添加到监控池成功!"
+	case "/pause":
+		minutes := 0
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return "用法：/pause [分钟]"
+			}
+			minutes = n
+		}
+		if err := Pause(email, time.Duration(minutes)*time.Minute); err != nil {
+			return "暂停失败：" + err.Error()
+		}
+		if minutes == 0 {
+			return "已暂停监控，发送 /resume 恢复"
+		}
+		return fmt.Sprintf("已暂停监控 %d 分钟", minutes)
+	case "/resume":
+		Resume(email)
+		return "已恢复监控"
+	case "/history":
+		limit := 10
+		if len(args) > 0 {
+			if n, err := strconv.Atoi(args[0]); err == nil && n > 0 && n <= 50 {
+				limit = n
+			}
+		}
+		return telegramHistory(email, limit)
+	}
+	return "未知命令\n\n" + telegramHelp
+}
+
+// telegramEmail 查找绑定到该 chat id 的账号
+func telegramEmail(chatID string) string {
+	all, err := config.ListAccountSettings()
+	if err != nil {
+		log.Println("Error reading account settings:", err)
+		return ""
+	}
+	for _, s := range all {
+		for _, ch := range s.Channels {
+			if ch.Type == "telegram" && ch.Target == chatID {
+				return s.Email
+			}
+		}
+	}
+	return ""
+}
+
+// 绑定验证码的有效期与允许输错的次数
+const (
+	telegramBindTTL      = 10 * time.Minute
+	telegramBindMaxTries = 5
+)
+
+func telegramBindKey(chatID string) string {
+	return "wzj:telegram:bind:" + chatID
+}
+
+// telegramRequestBind 向邮箱发送一次性验证码，只有能收到这封邮件的人才能把会话绑定到该账号。
+// 未启用邮件时无法验证，只有配置了 telegram.allowed_chats（会话均由管理员指定）才直接绑定。
+func telegramRequestBind(chatID string, email string) string {
+	email = config.NormalizeEmail(email)
+	if !viper.GetBool("mail.enabled") {
+		if len(viper.GetStringSlice("telegram.allowed_chats")) > 0 {
+			return telegramBind(chatID, email)
+		}
+		return "未启用邮件，无法验证邮箱归属；请管理员配置 telegram.allowed_chats 后再绑定"
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "绑定失败：" + err.Error()
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	key := telegramBindKey(chatID)
+	if err := db.RedisSet(key, email+" "+code, telegramBindTTL).Err(); err != nil {
+		return "绑定失败：" + err.Error()
+	}
+	_ = db.RedisDel(key + ":tries").Err()
+
+	text := fmt.Sprintf("验证码：%s\n\n在 Telegram 会话（chat id: %s）中发送 /bind %s %s 完成绑定，%d 分钟内有效。\n如果不是你本人操作，请忽略这封邮件。",
+		code, chatID, email, code, int(telegramBindTTL/time.Minute))
+	if err := mail.Send("Telegram 绑定验证码", text, email); err != nil {
+		log.Println("Error sending telegram bind code:", err)
+		return "验证码发送失败，请稍后再试"
+	}
+	return fmt.Sprintf("验证码已发送到 %s，请在 %d 分钟内发送 /bind %s <验证码> 完成绑定", email, int(telegramBindTTL/time.Minute), email)
+}
+
+// telegramConfirmBind 校验验证码并完成绑定，输错 telegramBindMaxTries 次后验证码作废
+func telegramConfirmBind(chatID string, email string, code string) string {
+	email = config.NormalizeEmail(email)
+	key := telegramBindKey(chatID)
+	v, err := db.RedisGet(key).Result()
+	if err != nil {
+		return "没有待验证的绑定或验证码已过期，请重新发送 /bind <邮箱>"
+	}
+	parts := strings.SplitN(v, " ", 2)
+	if len(parts) != 2 || parts[0] != email || parts[1] != strings.TrimSpace(code) {
+		tries, err := db.RedisIncr(key + ":tries").Result()
+		if err == nil {
+			_ = db.RedisExpire(key+":tries", telegramBindTTL).Err()
+		}
+		if err != nil || tries >= telegramBindMaxTries {
+			_ = db.RedisDel(key).Err()
+			_ = db.RedisDel(key + ":tries").Err()
+			return "验证码错误次数过多，请重新发送 /bind <邮箱>"
+		}
+		return "验证码错误"
+	}
+	_ = db.RedisDel(key).Err()
+	_ = db.RedisDel(key + ":tries").Err()
+	return telegramBind(chatID, email)
+}
+
+func telegramBind(chatID string, email string) string {
+	s, err := config.GetAccountSettings(email)
+	if err != nil {
+		return "绑定失败：" + err.Error()
+	}
+	for _, ch := range s.Channels {
+		if ch.Type == "telegram" && ch.Target == chatID {
+			return "已经绑定到 " + s.Email
+		}
+	}
+	// 账号之前没有配置渠道时默认发邮件，绑定后保留邮件渠道
+	if len(s.Channels) == 0 {
+		s.Channels = append(s.Channels, config.NotifyChannel{Type: "email", Enabled: true})
+	}
+	s.Channels = append(s.Channels, config.NotifyChannel{
+		ID:      "telegram-" + chatID,
+		Type:    "telegram",
+		Enabled: true,
+		Target:  chatID,
+	})
+	if _, err := config.UpdateAccountSettings(s); err != nil {
+		return "绑定失败：" + err.Error()
+	}
+	return "已绑定到 " + s.Email + "，签到与二维码提醒会发到这里"
+}
+
+func telegramStatus(email string) string {
+	var b strings.Builder
+	openIds := OpenIdsByEmail(email)
+	fmt.Fprintf(&b, "账号：%s\n", email)
+	if until, paused := PausedUntil(email); paused {
+		if until.IsZero() {
+			b.WriteString("状态：已暂停\n")
+		} else {
+			fmt.Fprintf(&b, "状态：暂停到 %s\n", until.Format("01-02 15:04"))
+		}
+	} else {
+		b.WriteString("状态：监控中\n")
+	}
+	if len(openIds) == 0 {
+		b.WriteString("监控池中没有该账号的 OpenID，发送 /add <openid> 添加")
+	}
+	for _, id := range openIds {
+		ttl := ""
+		if d, err := db.RedisTTL("wzj:user:" + id).Result(); err == nil && d > 0 {
+			ttl = fmt.Sprintf("（剩余 %s）", d.Round(time.Minute))
+		}
+		fmt.Fprintf(&b, "- %s%s\n", maskOpenId(id), ttl)
+	}
+	for _, sub := range qr.List() {
+		for _, id := range sub.Accounts {
+			for _, mine := range openIds {
+				if id == mine {
+					fmt.Fprintf(&b, "二维码签到进行中：C%d / S%d\n", sub.CourseId, sub.SignId)
+				}
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func telegramHistory(email string, limit int) string {
+	openIds := OpenIdsByEmail(email)
+	if len(openIds) == 0 {
+		return "监控池中没有该账号的 OpenID"
+	}
+	events, _, err := history.Query(history.Filter{OpenIds: openIds}, "", limit)
+	if err != nil {
+		return "查询失败：" + err.Error()
+	}
+	if len(events) == 0 {
+		return "暂无签到记录"
+	}
+	var b strings.Builder
+	for _, e := range events {
+		fmt.Fprintf(&b, "%s %s %s", e.Time.Format("01-02 15:04"), e.Type, e.CourseName)
+		if e.Mode != "" {
+			b.WriteString(" [" + e.Mode + "]")
+		}
+		if e.Result != "" {
+			b.WriteString(" " + e.Result)
+		}
+		if e.Reason != "" {
+			b.WriteString("（" + e.Reason + "）")
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -6,6 +6,10 @@
 	const SETTINGS_KEY = "wzj.settings.v1";
 	const EVENTS_KEY = "wzj.events.v1";
 	const POLL_KEY = "wzj.poll.v1";
+	const LAST_EVENT_ID_KEY = "wzj.lastEventId.v1";
+	const QR_SHOWN_KEY = "wzj.qrShown.v1";
+	// 超过这个时间的二维码提醒（断线补发、重新打开页面时的回放）只记入事件列表，不再弹窗
+	const QR_POPUP_MAX_AGE_MS = 2 * 60 * 1000;
 
 	const HELP_TEXT =
 		"快速开始\n" +
@@ -249,9 +253,9 @@
 
 	// ===== polling multi-openId =====
 	let pendingQrTimer = null;
+	let eventSource = null;
 	let monitoredOpenIds = [];
 	let monitoredIndex = 0;
-	let pendingQrLastShownByOpenId = Object.create(null);
 
 	const monitorCount = $id("monitorCount");
 	const pollHint = $id("pollHint");
@@ -307,10 +311,151 @@
 			clearInterval(pendingQrTimer);
 			pendingQrTimer = null;
 		}
+		if (eventSource) {
+			eventSource.close();
+			eventSource = null;
+		}
 		savePollState(false);
 		setPollHint();
 	}
 
+	// 已提醒过的二维码签到（openId:signId -> 时间），存在 localStorage 里，多个标签页和刷新后都不重复弹窗
+	function markQrShown(key) {
+		let shown = {};
+		try {
+			shown = JSON.parse(localStorage.getItem(QR_SHOWN_KEY) || "{}") || {};
+		} catch {
+			shown = {};
+		}
+		if (shown[key]) return false;
+		const now = Date.now();
+		for (const k of Object.keys(shown)) {
+			if (now - shown[k] > 86400000) delete shown[k];
+		}
+		shown[key] = now;
+		try {
+			localStorage.setItem(QR_SHOWN_KEY, JSON.stringify(shown));
+		} catch {
+			// ignore
+		}
+		return true;
+	}
+
+	function showPendingQr(openId, url, signId, stale) {
+		if (!markQrShown(signId ? openId + ":" + signId : url)) return;
+		addEvent({ type: "qr", url, signId, openId });
+		if (stale) return;
+
+		// 尝试自动打开新标签页（可能会被浏览器拦截）
+		let opened = false;
+		try {
+			const w = window.open(url, "_blank", "noopener,noreferrer");
+			opened = !!w;
+		} catch {
+			opened = false;
+		}
+
+		if (modalActionBtn) {
+			modalActionBtn.style.display = "inline-flex";
+			modalActionBtn.textContent = "打开二维码页面";
+			modalActionBtn.onclick = () => window.open(url, "_blank", "noopener,noreferrer");
+		}
+
+		const tip =
+			"检测到二维码签到，需要手动用微信扫一扫完成。\n" +
+			(openId ? "openid：" + openId + "\n" : "") +
+			(signId ? "signId：" + signId + "\n" : "") +
+			"点击『打开二维码页面』即可查看二维码。\n" +
+			(!opened ? "（若未自动打开新页面，可能被浏览器拦截弹窗）" : "");
+
+		openModal(tip);
+	}
+
+	// 服务端推送（SSE）：不消费事件，多标签页/多设备都能收到；断线后浏览器自动带 Last-Event-ID 补发
+	function startEventStream() {
+		let lastId = "";
+		try {
+			lastId = localStorage.getItem(LAST_EVENT_ID_KEY) || "";
+		} catch {
+			lastId = "";
+		}
+		const qs = lastId ? "?lastEventId=" + encodeURIComponent(lastId) : "";
+		eventSource = new EventSource("/api/events/stream" + qs);
+
+		const remember = (msg) => {
+			if (!msg.lastEventId) return;
+			try {
+				localStorage.setItem(LAST_EVENT_ID_KEY, msg.lastEventId);
+			} catch {
+				// ignore
+			}
+		};
+		const parse = (msg) => {
+			try {
+				return JSON.parse(msg.data);
+			} catch {
+				return null;
+			}
+		};
+
+		eventSource.addEventListener("detected", (msg) => {
+			remember(msg);
+			const e = parse(msg);
+			if (!e || e.mode !== "qr") return;
+			const url =
+				"/static/qr.html?sign=" +
+				encodeURIComponent(e.signId) +
+				"&course=" +
+				encodeURIComponent(e.courseId) +
+				"&openid=" +
+				encodeURIComponent(e.openId || "") +
+				"&v=" +
+				Date.now();
+			const at = Date.parse(e.time || "");
+			const stale = !isNaN(at) && Date.now() - at > QR_POPUP_MAX_AGE_MS;
+			showPendingQr(String(e.openId || ""), url, String(e.signId || ""), stale);
+			if ($id("eventList")) renderEvents();
+		});
+		eventSource.addEventListener("attempt", (msg) => {
+			remember(msg);
+			const e = parse(msg);
+			if (!e || e.result !== "success") return;
+			addEvent({
+				type: "signin",
+				mode: e.mode ? String(e.mode) : "",
+				openId: String(e.openId || ""),
+				courseId: e.courseId,
+				signId: e.signId,
+				courseName: e.courseName ? String(e.courseName) : "",
+				studentRank: e.studentRank || undefined,
+				signRank: e.signRank || undefined,
+			});
+			if ($id("eventList")) renderEvents();
+		});
+		eventSource.addEventListener("completed", (msg) => {
+			remember(msg);
+			const e = parse(msg);
+			if (!e || e.result !== "success") return;
+			addEvent({
+				type: "signin",
+				mode: "qr",
+				openId: String(e.openId || ""),
+				courseId: e.courseId,
+				signId: e.signId,
+				courseName: e.courseName ? String(e.courseName) : "",
+			});
+			if ($id("eventList")) renderEvents();
+		});
+		eventSource.addEventListener("expired", (msg) => {
+			remember(msg);
+			const e = parse(msg);
+			if (!e) return;
+			addEvent({ type: "expired", openId: String(e.openId || "") });
+			refreshMonitoredOpenIds().then(setPollHint);
+			if ($id("eventList")) renderEvents();
+		});
+	}
+
 	async function startPendingQrPollAll() {
 		stopPendingQrPoll();
 		savePollState(true);
@@ -323,6 +468,11 @@
 		}
 		setPollHint();
 
+		if (window.EventSource) {
+			startEventStream();
+			return;
+		}
+
 		pendingQrTimer = setInterval(async () => {
 			const st = loadPollState();
 			if (!st.enabled) return;
@@ -349,38 +499,7 @@
 						if (data) {
 							const url = data.url ? String(data.url) : "";
 							const signId = data.signId ? String(data.signId) : "";
-							if (url) {
-								const last = pendingQrLastShownByOpenId[openId] || "";
-								if (url !== last) {
-									pendingQrLastShownByOpenId[openId] = url;
-									addEvent({ type: "qr", url, signId, openId });
-
-									// 尝试自动打开新标签页（可能会被浏览器拦截）
-									let opened = false;
-									try {
-										const w = window.open(url, "_blank", "noopener,noreferrer");
-										opened = !!w;
-									} catch {
-										opened = false;
-									}
-
-									if (modalActionBtn) {
-										modalActionBtn.style.display = "inline-flex";
-										modalActionBtn.textContent = "打开二维码页面";
-										modalActionBtn.onclick = () =>
-											window.open(url, "_blank", "noopener,noreferrer");
-									}
-
-									const tip =
-										"检测到二维码签到，需要手动用微信扫一扫完成。\n" +
-										(openId ? "openid：" + openId + "\n" : "") +
-										(signId ? "signId：" + signId + "\n" : "") +
-										"点击『打开二维码页面』即可查看二维码。\n" +
-										(!opened ? "（若未自动打开新页面，可能被浏览器拦截弹窗）" : "");
-
-									openModal(tip);
-								}
-							}
+							if (url) showPendingQr(openId, url, signId);
 						}
 					}
 				}
@@ -621,7 +740,7 @@
 				const courseName = String(e.courseName || "");
 				const courseId = e.courseId != null ? String(e.courseId) : "";
 				const signId = e.signId != null ? String(e.signId) : "";
-				const title = mode === "gps" ? "GPS 签到成功" : "普通签到成功";
+				const title = mode === "qr" ? "二维码签到完成" : mode === "gps" ? "GPS 签到成功" : "普通签到成功";
 				const rankLine =
 					e.studentRank != null && e.signRank != null
 						? `签到No.<span class="mono">${String(e.signRank)}</span> · 你是第 <span class="mono">${String(
@@ -635,6 +754,13 @@
 					${courseId || signId ? `<div class="hint" style="margin-top:6px">C${courseId || "?"} / S${signId || "?"}</div>` : ""}
 					${rankLine ? `<div class="hint" style="margin-top:6px">${rankLine}</div>` : ""}
 				`;
+			} else if (e.type === "expired") {
+				const openId = String(e.openId || "");
+				card.innerHTML = `
+					<div style="font-weight:800">OpenID 已失效</div>
+					<div class="hint" style="margin-top:4px">${when}</div>
+					${openId ? `<div class="hint mono" style="margin-top:10px">openid: ${openId}</div>` : ""}
+				`;
 			} else {
 				card.innerHTML = `<div style="font-weight:800">事件</div><div class="hint" style="margin-top:4px">${when}</div>`;
 			}
@@ -784,6 +910,227 @@
 		}
 	}
 
+	// ===== web push =====
+	function webPushSupported() {
+		return "serviceWorker" in navigator && "PushManager" in window && "Notification" in window;
+	}
+
+	function urlBase64ToUint8Array(base64) {
+		const padded = (base64 + "=".repeat((4 - (base64.length % 4)) % 4))
+			.replace(/-/g, "+")
+			.replace(/_/g, "/");
+		const raw = atob(padded);
+		return Uint8Array.from(raw, (c) => c.charCodeAt(0));
+	}
+
+	async function currentPushSubscription() {
+		const reg = await navigator.serviceWorker.getRegistration("/");
+		return reg ? reg.pushManager.getSubscription() : null;
+	}
+
+	async function setWebPushHint() {
+		const hint = $id("webPushHint");
+		if (!hint) return;
+		if (!webPushSupported()) {
+			hint.textContent = "当前浏览器不支持推送（iOS 需先“添加到主屏幕”）";
+			return;
+		}
+		const sub = await currentPushSubscription().catch(() => null);
+		hint.textContent = sub ? "推送已开启" : "推送未开启";
+	}
+
+	async function enableWebPush() {
+		if (!webPushSupported()) throw new Error("当前浏览器不支持推送");
+		const email = String(loadSettings().defaultEmail || "").trim();
+		if (!email) throw new Error("请先在设置页填写默认邮箱");
+
+		const permission = await Notification.requestPermission();
+		if (permission !== "granted") throw new Error("没有获得通知权限");
+
+		const keyResp = await fetch("/api/webpush/key", { cache: "no-store" });
+		const keyData = (await safeReadJson(keyResp)) || {};
+		if (!keyResp.ok || !keyData.publicKey) throw new Error(keyData.error || "获取推送公钥失败");
+
+		const reg = await navigator.serviceWorker.register("/sw.js", { scope: "/" });
+		await navigator.serviceWorker.ready;
+		let sub = await reg.pushManager.getSubscription();
+		if (!sub) {
+			sub = await reg.pushManager.subscribe({
+				userVisibleOnly: true,
+				applicationServerKey: urlBase64ToUint8Array(keyData.publicKey),
+			});
+		}
+		const resp = await fetch("/api/webpush/subscribe", {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify({ email, subscription: sub.toJSON() }),
+		});
+		const data = (await safeReadJson(resp)) || {};
+		if (!resp.ok) throw new Error(data.error || "保存订阅失败");
+		return email;
+	}
+
+	async function disableWebPush() {
+		const sub = await currentPushSubscription();
+		if (!sub) return;
+		const email = String(loadSettings().defaultEmail || "").trim();
+		if (email) {
+			await fetch("/api/webpush/unsubscribe", {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ email, endpoint: sub.endpoint }),
+			});
+		}
+		await sub.unsubscribe();
+	}
+
+	function wireWebPush() {
+		const enableBtn = $id("webPushEnableBtn");
+		const disableBtn = $id("webPushDisableBtn");
+		if (!enableBtn && !disableBtn) return;
+		setWebPushHint();
+
+		if (enableBtn) {
+			enableBtn.addEventListener("click", async () => {
+				try {
+					const email = await enableWebPush();
+					openModal("已开启浏览器推送：" + email + " 的签到与二维码提醒会推送到这台设备。");
+				} catch (e) {
+					openModal("开启推送失败：" + (e && e.message ? e.message : e));
+				}
+				setWebPushHint();
+			});
+		}
+		if (disableBtn) {
+			disableBtn.addEventListener("click", async () => {
+				try {
+					await disableWebPush();
+					openModal("已关闭浏览器推送。");
+				} catch (e) {
+					openModal("关闭推送失败：" + (e && e.message ? e.message : e));
+				}
+				setWebPushHint();
+			});
+		}
+	}
+
+	// ===== notification preferences =====
+	const EVENT_LABELS = {
+		sign_detected: "发现签到",
+		signed: "签到成功",
+		sign_failed: "签到失败",
+		qr_required: "需要扫码",
+		openid_expired: "OpenID 失效",
+		digest: "日报/周报",
+	};
+
+	function renderPreferenceTable(table, data) {
+		table.textContent = "";
+		const events = Array.isArray(data.events) ? data.events : [];
+		const head = table.insertRow();
+		const corner = document.createElement("th");
+		corner.textContent = "渠道";
+		head.appendChild(corner);
+		events.forEach((ev) => {
+			const th = document.createElement("th");
+			th.textContent = EVENT_LABELS[ev] || ev;
+			head.appendChild(th);
+		});
+
+		(Array.isArray(data.channels) ? data.channels : []).forEach((ch) => {
+			const row = table.insertRow();
+			row.dataset.channel = ch.id;
+			const name = row.insertCell();
+			name.textContent = ch.id;
+			if (ch.target && ch.type === "email") name.title = ch.target;
+			const subscribed = Array.isArray(ch.events) ? ch.events : [];
+			events.forEach((ev) => {
+				const box = document.createElement("input");
+				box.type = "checkbox";
+				box.value = ev;
+				box.checked = subscribed.includes(ev);
+				row.insertCell().appendChild(box);
+			});
+		});
+	}
+
+	function wirePreferences() {
+		const table = $id("prefTable");
+		const saveBtn = $id("savePrefsBtn");
+		const prefHint = $id("prefHint");
+		const quietEnabled = $id("quietEnabled");
+		const quietStart = $id("quietStart");
+		const quietEnd = $id("quietEnd");
+		const quietHint = $id("quietHint");
+		if (!table || !saveBtn) return;
+		let quietTimezone = "";
+
+		async function loadPreferences() {
+			const email = String(loadSettings().defaultEmail || "").trim();
+			if (!email) {
+				if (prefHint) prefHint.textContent = "请先保存默认邮箱，再设置通知偏好";
+				return;
+			}
+			try {
+				const resp = await fetch("/api/accounts/preferences?email=" + encodeURIComponent(email), {
+					cache: "no-store",
+				});
+				const data = (await safeReadJson(resp)) || {};
+				if (!resp.ok) {
+					if (prefHint) prefHint.textContent = data.error || "读取通知偏好失败";
+					return;
+				}
+				if (prefHint) prefHint.textContent = email + " 的通知设置（保存在本机服务器）";
+				renderPreferenceTable(table, data);
+				const q = data.quietHours || {};
+				quietTimezone = q.timezone || "";
+				if (quietEnabled) quietEnabled.value = q.enabled ? "on" : "off";
+				if (quietStart && q.start) quietStart.value = q.start;
+				if (quietEnd && q.end) quietEnd.value = q.end;
+				if (quietHint && data.held > 0) {
+					quietHint.textContent = "当前有 " + data.held + " 条通知等待免打扰结束后发送；二维码签到提醒仍会立即发送";
+				}
+			} catch {
+				if (prefHint) prefHint.textContent = "读取通知偏好失败：网络或服务异常";
+			}
+		}
+
+		saveBtn.addEventListener("click", async () => {
+			const email = String(loadSettings().defaultEmail || "").trim();
+			if (!email) return openModal("请先保存默认邮箱。");
+			const channels = {};
+			table.querySelectorAll("tr[data-channel]").forEach((row) => {
+				channels[row.dataset.channel] = Array.from(row.querySelectorAll("input:checked")).map((x) => x.value);
+			});
+			const quietHours = {
+				enabled: quietEnabled ? quietEnabled.value === "on" : false,
+				start: quietStart ? quietStart.value : "",
+				end: quietEnd ? quietEnd.value : "",
+				timezone: quietTimezone,
+			};
+			try {
+				const resp = await fetch("/api/accounts/preferences", {
+					method: "POST",
+					headers: { "Content-Type": "application/json" },
+					body: JSON.stringify({ email, channels, quietHours }),
+				});
+				const data = (await safeReadJson(resp)) || {};
+				if (!resp.ok) {
+					openModal(data.error || "保存失败。请检查输入。");
+					return;
+				}
+				openModal(data.message || "通知偏好已保存。");
+				loadPreferences();
+			} catch {
+				openModal("保存失败：网络或服务异常。");
+			}
+		});
+
+		const saveDefaultEmailBtn = $id("saveDefaultEmailBtn");
+		if (saveDefaultEmailBtn) saveDefaultEmailBtn.addEventListener("click", loadPreferences);
+		syncFrontendSettingsFromServer().finally(loadPreferences);
+	}
+
 	// ===== settings page =====
 	function wireSettingsPage() {
 		const saveDefaultEmailBtn = $id("saveDefaultEmailBtn");
@@ -832,6 +1179,27 @@
 		const mailFrom = $id("mailFrom");
 		const mailPassword = $id("mailPassword");
 		const mailPasswordHint = $id("mailPasswordHint");
+		const mailSecurity = $id("mailSecurity");
+		const mailAuth = $id("mailAuth");
+		const mailHelo = $id("mailHelo");
+		const mailInsecure = $id("mailInsecure");
+		const testEmailTo = $id("testEmailTo");
+		const sendTestEmailBtn = $id("sendTestEmailBtn");
+
+		function readMailForm(portVal) {
+			return {
+				enabled: mailEnabled ? mailEnabled.value === "on" : false,
+				host: mailHost ? String(mailHost.value || "").trim() : "",
+				port: portVal,
+				username: mailUsername ? String(mailUsername.value || "").trim() : "",
+				password: mailPassword ? String(mailPassword.value || "") : "",
+				from: mailFrom ? String(mailFrom.value || "").trim() : "",
+				security: mailSecurity ? mailSecurity.value : "",
+				auth: mailAuth ? mailAuth.value : "",
+				helo: mailHelo ? String(mailHelo.value || "").trim() : "",
+				insecure_skip_verify: mailInsecure ? mailInsecure.value === "on" : false,
+			};
+		}
 
 		async function loadServerConfig() {
 			if (!normalDelay || !mailEnabled) return;
@@ -849,6 +1217,11 @@
 				if (mailPort) mailPort.value = String((data.mail && data.mail.port) || "");
 				if (mailUsername) mailUsername.value = String((data.mail && data.mail.username) || "");
 				if (mailFrom) mailFrom.value = String((data.mail && data.mail.from) || "");
+				if (mailSecurity) mailSecurity.value = String((data.mail && data.mail.security) || "");
+				if (mailAuth) mailAuth.value = String((data.mail && data.mail.auth) || "");
+				if (mailHelo) mailHelo.value = String((data.mail && data.mail.helo) || "");
+				if (mailInsecure) mailInsecure.value = data.mail && data.mail.insecure_skip_verify ? "on" : "off";
+				if (testEmailTo && !testEmailTo.value) testEmailTo.value = loadSettings().defaultEmail || "";
 
 				if (mailPasswordHint) {
 					mailPasswordHint.textContent = data.passwordSet
@@ -883,14 +1256,7 @@
 
 					const payload = {
 						normal_delay: delayVal,
-						mail: {
-							enabled: mailEnabled ? mailEnabled.value === "on" : false,
-							host: mailHost ? String(mailHost.value || "").trim() : "",
-							port: portVal,
-							username: mailUsername ? String(mailUsername.value || "").trim() : "",
-							password: mailPassword ? String(mailPassword.value || "") : "",
-							from: mailFrom ? String(mailFrom.value || "").trim() : "",
-						},
+						mail: readMailForm(portVal),
 					};
 
 					const resp = await fetch("/api/appconfig", {
@@ -916,6 +1282,37 @@
 				}
 			});
 		}
+
+		if (sendTestEmailBtn) {
+			sendTestEmailBtn.addEventListener("click", async () => {
+				const to = testEmailTo ? String(testEmailTo.value || "").trim() : "";
+				if (!to) {
+					openModal("请填写测试邮件的收件邮箱。");
+					return;
+				}
+				const portVal = mailPort && String(mailPort.value).trim() !== "" ? Number(mailPort.value) : 0;
+				sendTestEmailBtn.disabled = true;
+				try {
+					const resp = await fetch("/api/appconfig/test-email", {
+						method: "POST",
+						headers: { "Content-Type": "application/json" },
+						body: JSON.stringify({ to, mail: readMailForm(portVal) }),
+					});
+					const data = (await safeReadJson(resp)) || {};
+					if (!resp.ok) {
+						let msg = "测试邮件发送失败";
+						if (data.stage) msg += "（步骤：" + data.stage + (data.code ? "，响应码 " + data.code : "") + "）";
+						openModal(msg + "：\n" + (data.error || "未知错误"));
+						return;
+					}
+					openModal(data.message || "测试邮件已发送。");
+				} catch {
+					openModal("发送失败：网络或服务异常。");
+				} finally {
+					sendTestEmailBtn.disabled = false;
+				}
+			});
+		}
 	}
 
 	function wireHelpButtons() {
@@ -957,7 +1354,9 @@
 	renderAll();
 	wireSubmitPage();
 	wireHistoryPage();
+	wireWebPush();
 	wireSettingsPage();
+	wirePreferences();
 	wireHelpButtons();
 
 	refreshMonitoredOpenIds();
@@ -0,0 +1,36 @@
+// Web Push：页面关闭后仍能收到签到与二维码提醒
+self.addEventListener("install", () => self.skipWaiting());
+self.addEventListener("activate", (event) => event.waitUntil(self.clients.claim()));
+
+self.addEventListener("push", (event) => {
+	let data = {};
+	try {
+		data = event.data ? event.data.json() : {};
+	} catch {
+		data = { title: "签到通知", body: event.data ? event.data.text() : "" };
+	}
+	const title = data.title || "签到通知";
+	event.waitUntil(
+		self.registration.showNotification(title, {
+			body: data.body || "",
+			icon: "/static/logo_github.png",
+			tag: data.tag || undefined,
+			renotify: !!data.tag,
+			requireInteraction: !!data.requireInteraction,
+			data: { url: data.url || "/history" },
+		})
+	);
+});
+
+self.addEventListener("notificationclick", (event) => {
+	event.notification.close();
+	const url = (event.notification.data && event.notification.data.url) || "/history";
+	event.waitUntil(
+		self.clients.matchAll({ type: "window", includeUncontrolled: true }).then((list) => {
+			for (const client of list) {
+				if (client.url === url && "focus" in client) return client.focus();
+			}
+			return self.clients.openWindow(url);
+		})
+	);
+});
@@ -0,0 +1,144 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Client 是 Telegram Bot API 的最小客户端。Base 可指向本地桩服务，便于测试。
+type Client struct {
+	Base  string
+	Token string
+	HTTP  *http.Client
+}
+
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+type Message struct {
+	MessageID int    `json:"message_id"`
+	From      *User  `json:"from"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+type Update struct {
+	UpdateID int      `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+type response struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+// FromConfig 读取 telegram.* 配置，未启用或缺少 token 时返回 false
+func FromConfig() (*Client, bool) {
+	token := strings.TrimSpace(viper.GetString("telegram.token"))
+	if !viper.GetBool("telegram.enabled") || token == "" {
+		return nil, false
+	}
+	return &Client{
+		Base:  strings.TrimRight(viper.GetString("telegram.api_base"), "/"),
+		Token: token,
+		HTTP:  &http.Client{Timeout: 90 * time.Second},
+	}, true
+}
+
+func (c *Client) endpoint(method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", c.Base, c.Token, method)
+}
+
+func (c *Client) do(req *http.Request, out interface{}) error {
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("telegram: decode response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if !r.OK {
+		return errors.New("telegram: " + r.Description)
+	}
+	if out != nil {
+		return json.Unmarshal(r.Result, out)
+	}
+	return nil
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, out interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(method), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, out)
+}
+
+func (c *Client) SendMessage(ctx context.Context, chatID string, text string) error {
+	return c.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}, nil)
+}
+
+// SendPhoto 以 multipart 上传 PNG 图片
+func (c *Client) SendPhoto(ctx context.Context, chatID string, png []byte, caption string) error {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	_ = w.WriteField("chat_id", chatID)
+	if caption != "" {
+		_ = w.WriteField("caption", caption)
+	}
+	part, err := w.CreateFormFile("photo", "qr.png")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(png); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("sendPhoto"), &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return c.do(req, nil)
+}
+
+// GetUpdates 长轮询获取新消息，timeout 单位为秒
+func (c *Client) GetUpdates(ctx context.Context, offset int, timeout int) ([]Update, error) {
+	var updates []Update
+	err := c.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         timeout,
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
@@ -0,0 +1,244 @@
+// Package webpush 实现标准 Web Push：RFC 8291 消息加密（aes128gcm）与 RFC 8292 VAPID 认证
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// 单条记录的大小；负载加上填充分隔符与 GCM 标签必须放得进一条记录
+const recordSize = 4096
+
+// MaxPayload 是单条推送负载的上限
+const MaxPayload = recordSize - 17 - 1
+
+// ErrGone 表示订阅已失效（推送服务返回 404/410），调用方应删除该订阅
+var ErrGone = errors.New("push subscription is gone")
+
+// Subscription 对应浏览器 PushSubscription.toJSON() 的结果
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Validate 检查订阅地址与密钥格式
+func (s Subscription) Validate() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("endpoint must be an https URL")
+	}
+	if _, err := s.uaPublic(); err != nil {
+		return err
+	}
+	if _, err := s.authSecret(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func decode(s string) ([]byte, error) {
+	// 浏览器给的是无填充 base64url，兼容带填充与标准 base64 的写法
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func (s Subscription) uaPublic() (*ecdh.PublicKey, error) {
+	b, err := decode(s.Keys.P256dh)
+	if err != nil {
+		return nil, errors.New("invalid p256dh key")
+	}
+	pub, err := ecdh.P256().NewPublicKey(b)
+	if err != nil {
+		return nil, errors.New("invalid p256dh key")
+	}
+	return pub, nil
+}
+
+func (s Subscription) authSecret() ([]byte, error) {
+	b, err := decode(s.Keys.Auth)
+	if err != nil || len(b) != 16 {
+		return nil, errors.New("invalid auth secret")
+	}
+	return b, nil
+}
+
+// Encrypt 按 RFC 8291 加密负载，返回 aes128gcm 编码的请求体
+func Encrypt(sub Subscription, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayload {
+		return nil, fmt.Errorf("payload too large: %d bytes", len(payload))
+	}
+	uaPub, err := sub.uaPublic()
+	if err != nil {
+		return nil, err
+	}
+	auth, err := sub.authSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	asPriv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encrypt(uaPub, auth, payload, asPriv, salt)
+}
+
+// encrypt 用给定的临时密钥与 salt 加密，RFC 8291 附录 A 的测试向量需要固定这两项
+func encrypt(uaPub *ecdh.PublicKey, auth []byte, payload []byte, asPriv *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	secret, err := asPriv.ECDH(uaPub)
+	if err != nil {
+		return nil, err
+	}
+	asPub := asPriv.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPub.Bytes()...)
+	keyInfo = append(keyInfo, asPub...)
+	ikm, err := derive(auth, secret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	cek, err := derive(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := derive(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 只有一条记录，以 0x02 作为最后一条记录的分隔符
+	plain := append(append([]byte{}, payload...), 0x02)
+
+	var buf bytes.Buffer
+	buf.Write(salt)
+	binary.Write(&buf, binary.BigEndian, uint32(recordSize))
+	buf.WriteByte(byte(len(asPub)))
+	buf.Write(asPub)
+	buf.Write(gcm.Seal(nil, nonce, plain, nil))
+	return buf.Bytes(), nil
+}
+
+func derive(salt, secret, info []byte, n int) ([]byte, error) {
+	out := make([]byte, n)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// vapidToken 生成 RFC 8292 的 ES256 JWT，aud 为推送服务的源
+func vapidToken(endpoint string, subject string, key *ecdsa.PrivateKey) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signing := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signing))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Options 是单次推送的参数
+type Options struct {
+	Subject   string            // VAPID 联系方式，mailto: 或 https: 地址
+	PublicKey string            // VAPID 公钥（base64url）
+	Key       *ecdsa.PrivateKey // VAPID 私钥
+	TTL       time.Duration     // 推送服务保留消息的时长
+	Urgency   string            // very-low / low / normal / high
+	Topic     string            // 同一 topic 的未送达消息会被新消息替换
+}
+
+// Send 加密并发送一条推送
+func Send(ctx context.Context, client *http.Client, sub Subscription, payload []byte, opt Options) error {
+	body, err := Encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+	token, err := vapidToken(sub.Endpoint, opt.Subject, opt.Key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "vapid t="+token+", k="+opt.PublicKey)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(opt.TTL/time.Second)))
+	if opt.Urgency != "" {
+		req.Header.Set("Urgency", opt.Urgency)
+	}
+	if opt.Topic != "" {
+		req.Header.Set("Topic", opt.Topic)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return fmt.Errorf("HTTP %d: %.200s", resp.StatusCode, msg)
+	}
+	return nil
+}
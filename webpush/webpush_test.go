@@ -0,0 +1,232 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decode %q: %v", s, err)
+	}
+	return b
+}
+
+// RFC 8291 附录 A 的测试向量
+func TestEncryptRFC8291Vector(t *testing.T) {
+	const (
+		plaintext = "When I grow up, I want to be a watermelon"
+		asPrivKey = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+		asPubKey  = "BP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A8"
+		uaPubKey  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+		salt      = "DGv6ra1nlYgDCS1FRnbzlw"
+		authKey   = "BTBZMqHH6r4Tts7J_aSIgg"
+		want      = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	)
+	asPriv, err := ecdh.P256().NewPrivateKey(mustDecode(t, asPrivKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(asPriv.PublicKey().Bytes()); got != asPubKey {
+		t.Fatalf("application server public key = %s", got)
+	}
+
+	var sub Subscription
+	sub.Endpoint = "https://push.example.net/push/JzLQ3raZJfFBR0aqvOMsLrt54w4rJUsV"
+	sub.Keys.P256dh = uaPubKey
+	sub.Keys.Auth = authKey
+	if err := sub.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	uaPub, _ := sub.uaPublic()
+	auth, _ := sub.authSecret()
+
+	body, err := encrypt(uaPub, auth, []byte(plaintext), asPriv, mustDecode(t, salt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(body); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// decryptForTest 按 RFC 8291 的接收方流程解密，用来验证随机密钥下 Encrypt 的输出
+func decryptForTest(t *testing.T, uaPriv *ecdh.PrivateKey, auth []byte, body []byte) []byte {
+	t.Helper()
+	if len(body) < 21 || int(body[20]) != 65 || len(body) < 21+65 {
+		t.Fatalf("bad header: %x", body)
+	}
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != recordSize {
+		t.Fatalf("record size = %d", rs)
+	}
+	asPub, err := ecdh.P256().NewPublicKey(body[21 : 21+65])
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := uaPriv.ECDH(asPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyInfo := append([]byte("WebPush: info\x00"), uaPriv.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, asPub.Bytes()...)
+	ikm, _ := derive(auth, secret, keyInfo, 32)
+	cek, _ := derive(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce, _ := derive(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plain, err := gcm.Open(nil, nonce, body[21+65:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) == 0 || plain[len(plain)-1] != 0x02 {
+		t.Fatalf("missing last-record delimiter: %x", plain)
+	}
+	return plain[:len(plain)-1]
+}
+
+func testSubscription(t *testing.T, endpoint string) (Subscription, *ecdh.PrivateKey, []byte) {
+	t.Helper()
+	uaPriv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	_, _ = rand.Read(auth)
+	var sub Subscription
+	sub.Endpoint = endpoint
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(uaPriv.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(auth)
+	return sub, uaPriv, auth
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	sub, uaPriv, auth := testSubscription(t, "https://push.example.net/x")
+	for _, payload := range [][]byte{nil, []byte(`{"title":"签到"}`), bytes.Repeat([]byte("a"), MaxPayload)} {
+		body, err := Encrypt(sub, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decryptForTest(t, uaPriv, auth, body); !bytes.Equal(got, payload) {
+			t.Errorf("decrypted %d bytes, want %d", len(got), len(payload))
+		}
+	}
+	if _, err := Encrypt(sub, make([]byte, MaxPayload+1)); err == nil {
+		t.Error("oversized payload accepted")
+	}
+}
+
+// verifyVapidToken 校验 ES256 签名并返回 claims
+func verifyVapidToken(t *testing.T, token string, pub *ecdsa.PublicKey) map[string]interface{} {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token has %d parts", len(parts))
+	}
+	var header map[string]string
+	if err := json.Unmarshal(mustDecode(t, parts[0]), &header); err != nil || header["alg"] != "ES256" || header["typ"] != "JWT" {
+		t.Fatalf("header = %v, %v", header, err)
+	}
+	sig := mustDecode(t, parts[2])
+	if len(sig) != 64 {
+		t.Fatalf("signature is %d bytes", len(sig))
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		t.Fatal("signature does not verify")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(mustDecode(t, parts[1]), &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestVapidToken(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := vapidToken("https://fcm.googleapis.com/fcm/send/abc?x=1", "mailto:admin@example.com", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verifyVapidToken(t, token, &key.PublicKey)
+	if claims["aud"] != "https://fcm.googleapis.com" || claims["sub"] != "mailto:admin@example.com" {
+		t.Errorf("claims = %v", claims)
+	}
+	// RFC 8292：exp 不能超过 24 小时
+	exp, _ := claims["exp"].(float64)
+	if d := time.Until(time.Unix(int64(exp), 0)); d <= 0 || d > 24*time.Hour {
+		t.Errorf("exp is %v from now", d)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	parts := strings.Split(token, ".")
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	sig := mustDecode(t, parts[2])
+	if ecdsa.Verify(&other.PublicKey, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Error("signature verifies with another key")
+	}
+}
+
+func TestSend(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var (
+		gotHeader http.Header
+		gotBody   []byte
+		status    = http.StatusCreated
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sub, uaPriv, auth := testSubscription(t, srv.URL+"/push/1")
+	opt := Options{Subject: "mailto:admin@example.com", PublicKey: "pub", Key: key, TTL: time.Hour, Urgency: "high", Topic: "qr"}
+	if err := Send(context.Background(), srv.Client(), sub, []byte("hello"), opt); err != nil {
+		t.Fatal(err)
+	}
+	if got := decryptForTest(t, uaPriv, auth, gotBody); string(got) != "hello" {
+		t.Errorf("payload = %q", got)
+	}
+	if gotHeader.Get("Content-Encoding") != "aes128gcm" || gotHeader.Get("TTL") != "3600" ||
+		gotHeader.Get("Urgency") != "high" || gotHeader.Get("Topic") != "qr" {
+		t.Errorf("headers = %v", gotHeader)
+	}
+	authz := gotHeader.Get("Authorization")
+	if !strings.HasPrefix(authz, "vapid t=") || !strings.HasSuffix(authz, ", k=pub") {
+		t.Fatalf("Authorization = %q", authz)
+	}
+	claims := verifyVapidToken(t, strings.TrimSuffix(strings.TrimPrefix(authz, "vapid t="), ", k=pub"), &key.PublicKey)
+	if claims["aud"] != srv.URL {
+		t.Errorf("aud = %v, want %s", claims["aud"], srv.URL)
+	}
+
+	status = http.StatusGone
+	if err := Send(context.Background(), srv.Client(), sub, []byte("hello"), opt); err != ErrGone {
+		t.Errorf("410 error = %v, want ErrGone", err)
+	}
+}